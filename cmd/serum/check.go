@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/wingocard/serum/internal/envparser"
+)
+
+const (
+	defaultNamingConvention = `^[A-Z_][A-Z0-9_]*$`
+	sarifSchema             = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion            = "2.1.0"
+	informationURI          = "https://github.com/wingocard/serum"
+)
+
+// ruleDescriptions describes the rules reported by serum check.
+var ruleDescriptions = map[string]string{
+	envparser.RuleMalformedLine:     "Lines must be empty, comments or KEY=value pairs.",
+	envparser.RuleEmptySecret:       "Secret references must not be empty.",
+	envparser.RuleDuplicateKey:      "Keys must be defined once per file.",
+	envparser.RuleUnterminatedValue: "Multiline values must be terminated with a double quote.",
+	ruleNamingConvention:            "Keys must match the naming convention.",
+	ruleMissingKey:                  "Keys required by the schema must be defined.",
+	ruleUnknownKey:                  "Keys must be defined in the schema.",
+	ruleExpectedSecret:              "Keys the schema declares as secrets must be secrets.",
+	ruleExpectedPlain:               "Keys the schema declares as plain text must not be secrets.",
+	rulePatternMismatch:             "Plain text values must match the pattern of the schema.",
+}
+
+// fileIssue is an issue found in a file.
+type fileIssue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// check lints .env files without decrypting their secrets and exits with a non zero
+// code when issues are found.
+func (c *cli) check(args []string) int {
+	var (
+		format     string
+		naming     string
+		schemaPath string
+	)
+	fs := c.flagSet("check")
+	fs.StringVar(&format, "format", "text", "output format: text, json or sarif")
+	fs.StringVar(&naming, "naming", defaultNamingConvention, "regular expression keys must match, empty to disable")
+	fs.StringVar(&schemaPath, "schema", "", "`path` of a JSON schema describing the expected keys")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	var write func(w io.Writer, issues []fileIssue) error
+	switch format {
+	case "text":
+		write = writeText
+	case "json":
+		write = writeJSON
+	case "sarif":
+		write = writeSARIF
+	default:
+		c.errorf("check: unknown format %q", format)
+		return exitUsage
+	}
+
+	var namingRe *regexp.Regexp
+	if naming != "" {
+		var err error
+		if namingRe, err = regexp.Compile(naming); err != nil {
+			c.errorf("check: invalid naming convention: %s", err)
+			return exitUsage
+		}
+	}
+
+	var s *schema
+	if schemaPath != "" {
+		var err error
+		if s, err = loadSchema(schemaPath); err != nil {
+			c.errorf("check: %s", err)
+			return exitError
+		}
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{defaultEnvFile}
+	}
+
+	issues := []fileIssue{}
+	for _, path := range files {
+		found, err := checkFile(path, namingRe, s)
+		if err != nil {
+			c.errorf("check: %s", err)
+			return exitError
+		}
+
+		for _, i := range found {
+			issues = append(issues, fileIssue{File: path, Line: i.Line, Key: i.Key, Rule: i.Rule, Message: i.Message})
+		}
+	}
+
+	if err := write(c.stdout, issues); err != nil {
+		c.errorf("check: %s", err)
+		return exitError
+	}
+
+	if len(issues) > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// checkFile returns the issues found in the .env file at path, sorted by line.
+func checkFile(path string, namingRe *regexp.Regexp, s *schema) ([]envparser.Issue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res, err := envparser.Lint(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	issues := res.Issues
+	if namingRe != nil {
+		for _, e := range res.Entries {
+			if !namingRe.MatchString(e.Key) {
+				issues = append(issues, envparser.Issue{
+					Line: e.Line, Key: e.Key, Rule: ruleNamingConvention,
+					Message: fmt.Sprintf("key %s does not match %s", e.Key, namingRe),
+				})
+			}
+		}
+	}
+	if s != nil {
+		issues = append(issues, s.check(res.Entries)...)
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Line < issues[j].Line
+	})
+	return issues, nil
+}
+
+func writeText(w io.Writer, issues []fileIssue) error {
+	for _, i := range issues {
+		var err error
+		if i.Line > 0 {
+			_, err = fmt.Fprintf(w, "%s:%d: %s (%s)\n", i.File, i.Line, i.Message, i.Rule)
+		} else {
+			_, err = fmt.Fprintf(w, "%s: %s (%s)\n", i.File, i.Message, i.Rule)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeJSON(w io.Writer, issues []fileIssue) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Issues []fileIssue `json:"issues"`
+	}{issues})
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+func writeSARIF(w io.Writer, issues []fileIssue) error {
+	ids := make([]string, 0, len(ruleDescriptions))
+	for id := range ruleDescriptions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	rules := make([]sarifRule, 0, len(ids))
+	for _, id := range ids {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: ruleDescriptions[id]}})
+	}
+
+	results := make([]sarifResult, 0, len(issues))
+	for _, i := range issues {
+		loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: i.File}}
+		if i.Line > 0 {
+			loc.Region = &sarifRegion{StartLine: i.Line}
+		}
+
+		results = append(results, sarifResult{
+			RuleID:    i.Rule,
+			Level:     "error",
+			Message:   sarifMessage{Text: i.Message},
+			Locations: []sarifLocation{{PhysicalLocation: loc}},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: "serum", InformationURI: informationURI, Rules: rules}},
+			Results: results,
+		}},
+	})
+}
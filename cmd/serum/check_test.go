@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const checkEnvFile = `# database
+DB_HOST=localhost
+DB_PASSWORD=!{db-password}
+BAD_VALUE
+DB_HOST=127.0.0.1
+EMPTY=!{}
+db_user=admin
+CERT="-----BEGIN CERTIFICATE-----
+MIGbMBAGByqGSM49AgEGBSuBBAAjA4GGAAQAC6vH7IGAp8pdUt92yiDGKt9mAwN3
+`
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	valid := writeFile(t, dir, "valid.env", "DB_HOST=localhost\nDB_PASSWORD=!{db-password}\nPORT=5432\n", 0600)
+	invalid := writeFile(t, dir, "invalid.env", checkEnvFile, 0600)
+	schemaPath := writeFile(t, dir, "schema.json", `{
+		"additionalKeys": false,
+		"keys": {
+			"DB_HOST": {"required": true, "secret": false},
+			"DB_PASSWORD": {"required": true, "secret": true},
+			"DB_USER": {"required": true},
+			"PORT": {"pattern": "^[0-9]+$"}
+		}
+	}`, 0600)
+	schemaFile := writeFile(t, dir, "schema.env", "DB_HOST=!{db-host}\nDB_PASSWORD=hunter2\nPORT=http\nDEBUG=true\n", 0600)
+	badSchema := writeFile(t, dir, "bad_schema.json", `{"keys": {"PORT": {"pattern": "[0-9"}}}`, 0600)
+
+	tt := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			name: "valid",
+			args: []string{"check", valid},
+		},
+		{
+			name:         "issues",
+			args:         []string{"check", valid, invalid},
+			expectedCode: exitError,
+			expectedStdout: invalid + ":4: malformed line, expected KEY=value (malformed-line)\n" +
+				invalid + ":5: duplicate key DB_HOST, first defined on line 2 (duplicate-key)\n" +
+				invalid + ":6: secret reference is empty (empty-secret)\n" +
+				invalid + ":7: key db_user does not match ^[A-Z_][A-Z0-9_]*$ (naming-convention)\n" +
+				invalid + ":8: multiline value of CERT is never terminated with \" (unterminated-value)\n",
+		},
+		{
+			name:           "custom naming convention",
+			args:           []string{"check", "-naming", "^DB_", valid},
+			expectedCode:   exitError,
+			expectedStdout: valid + ":3: key PORT does not match ^DB_ (naming-convention)\n",
+		},
+		{
+			name: "naming convention disabled",
+			args: []string{"check", "-naming", "", writeFile(t, dir, "lower.env", "db_user=admin\n", 0600)},
+		},
+		{
+			name:           "schema",
+			args:           []string{"check", "-schema", schemaPath, valid},
+			expectedCode:   exitError,
+			expectedStdout: valid + ": required key DB_USER is missing (missing-key)\n",
+		},
+		{
+			name:         "schema issues",
+			args:         []string{"check", "-schema", schemaPath, schemaFile},
+			expectedCode: exitError,
+			expectedStdout: schemaFile + ": required key DB_USER is missing (missing-key)\n" +
+				schemaFile + ":1: DB_HOST must be a plain text value (expected-plain)\n" +
+				schemaFile + ":2: DB_PASSWORD must be a secret (expected-secret)\n" +
+				schemaFile + ":3: value of PORT does not match ^[0-9]+$ (pattern-mismatch)\n" +
+				schemaFile + ":4: key DEBUG is not defined in the schema (unknown-key)\n",
+		},
+		{
+			name:           "invalid schema pattern",
+			args:           []string{"check", "-schema", badSchema, valid},
+			expectedCode:   exitError,
+			expectedStderr: "invalid pattern of PORT",
+		},
+		{
+			name:           "missing schema",
+			args:           []string{"check", "-schema", filepath.Join(dir, "missing.json"), valid},
+			expectedCode:   exitError,
+			expectedStderr: "serum: check: error reading schema",
+		},
+		{
+			name:           "missing file",
+			args:           []string{"check", filepath.Join(dir, "missing.env")},
+			expectedCode:   exitError,
+			expectedStderr: "missing.env: no such file or directory",
+		},
+		{
+			name:           "unknown format",
+			args:           []string{"check", "-format", "xml", valid},
+			expectedCode:   exitUsage,
+			expectedStderr: `serum: check: unknown format "xml"`,
+		},
+		{
+			name:           "invalid naming convention",
+			args:           []string{"check", "-naming", "[A-Z", valid},
+			expectedCode:   exitUsage,
+			expectedStderr: "serum: check: invalid naming convention",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, "", tc.args...)
+			assert.Equal(t, code, tc.expectedCode, stderr)
+			assert.Equal(t, stdout, tc.expectedStdout)
+			assert.Assert(t, strings.Contains(stderr, tc.expectedStderr), stderr)
+		})
+	}
+}
+
+func TestCheckJSON(t *testing.T) {
+	invalid := writeFile(t, t.TempDir(), "invalid.env", checkEnvFile, 0600)
+
+	code, stdout, _ := runCLI(t, "", "check", "-format", "json", invalid)
+	assert.Equal(t, code, exitError)
+
+	var out struct {
+		Issues []fileIssue `json:"issues"`
+	}
+	assert.NilError(t, json.Unmarshal([]byte(stdout), &out))
+	assert.Equal(t, len(out.Issues), 5)
+	assert.DeepEqual(t, out.Issues[1], fileIssue{
+		File:    invalid,
+		Line:    5,
+		Key:     "DB_HOST",
+		Rule:    "duplicate-key",
+		Message: "duplicate key DB_HOST, first defined on line 2",
+	})
+
+	valid := writeFile(t, t.TempDir(), "valid.env", "DB_HOST=localhost\n", 0600)
+	code, stdout, _ = runCLI(t, "", "check", "-format", "json", valid)
+	assert.Equal(t, code, exitOK)
+	assert.Equal(t, stdout, "{\n  \"issues\": []\n}\n")
+}
+
+func TestCheckSARIF(t *testing.T) {
+	dir := t.TempDir()
+	invalid := writeFile(t, dir, "invalid.env", checkEnvFile, 0600)
+	schemaPath := writeFile(t, dir, "schema.json", `{"keys": {"DB_USER": {"required": true}}}`, 0600)
+
+	code, stdout, _ := runCLI(t, "", "check", "-format", "sarif", "-schema", schemaPath, invalid)
+	assert.Equal(t, code, exitError)
+
+	var log sarifLog
+	assert.NilError(t, json.Unmarshal([]byte(stdout), &log))
+	assert.Equal(t, log.Version, "2.1.0")
+	assert.Equal(t, len(log.Runs), 1)
+	assert.Equal(t, log.Runs[0].Tool.Driver.Name, "serum")
+	assert.Equal(t, len(log.Runs[0].Tool.Driver.Rules), len(ruleDescriptions))
+
+	results := log.Runs[0].Results
+	assert.Equal(t, len(results), 6)
+	assert.Equal(t, results[0].RuleID, "missing-key")
+	assert.Assert(t, results[0].Locations[0].PhysicalLocation.Region == nil)
+	assert.Equal(t, results[1].RuleID, "malformed-line")
+	assert.Equal(t, results[1].Level, "error")
+	assert.Equal(t, results[1].Locations[0].PhysicalLocation.ArtifactLocation.URI, invalid)
+	assert.Equal(t, results[1].Locations[0].PhysicalLocation.Region.StartLine, 4)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/wingocard/serum/internal/envparser"
+)
+
+// Kinds of differences reported by serum diff.
+const (
+	diffLeftOnly         = "left-only"
+	diffRightOnly        = "right-only"
+	diffValueChanged     = "value-changed"
+	diffReferenceChanged = "reference-changed"
+	diffSecretChanged    = "secret-changed"
+	diffTypeChanged      = "type-changed"
+
+	typePlain  = "plain"
+	typeSecret = "secret"
+
+	// exitDifferent is returned when the files differ, like diff does.
+	exitDifferent = 1
+	// exitTrouble is returned on errors, like diff does.
+	exitTrouble = 2
+
+	hashLength = 12
+)
+
+// diffSide is a key's value in one of the compared files. The value is only set for plain
+// text values and secrets are only described by their reference and, when decrypted, a hash.
+type diffSide struct {
+	Type      string `json:"type"`
+	Value     string `json:"value,omitempty"`
+	Reference string `json:"reference,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+}
+
+// difference is a key that differs between the compared files.
+type difference struct {
+	Key   string    `json:"key"`
+	Kind  string    `json:"kind"`
+	Left  *diffSide `json:"left,omitempty"`
+	Right *diffSide `json:"right,omitempty"`
+}
+
+// diff compares two .env files and exits with a non zero code when they differ.
+func (c *cli) diff(args []string) int {
+	var (
+		format  string
+		decrypt bool
+		pf      providerFlags
+	)
+	fs := c.flagSet("diff")
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.BoolVar(&decrypt, "decrypt", false,
+		"compare decrypted secrets, which are reported as hashes only comparable within the same output")
+	pf.register(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		if code == exitUsage {
+			return exitTrouble
+		}
+		return code
+	}
+
+	if fs.NArg() != 2 {
+		c.errorf("diff: expected two files to compare")
+		fs.Usage()
+		return exitTrouble
+	}
+	if format != "text" && format != "json" {
+		c.errorf("diff: unknown format %q", format)
+		return exitTrouble
+	}
+	leftPath, rightPath := fs.Arg(0), fs.Arg(1)
+
+	left, err := envparser.ParseFile(leftPath)
+	if err != nil {
+		c.errorf("diff: %s", err)
+		return exitTrouble
+	}
+	right, err := envparser.ParseFile(rightPath)
+	if err != nil {
+		c.errorf("diff: %s", err)
+		return exitTrouble
+	}
+
+	var leftHashes, rightHashes map[string]string
+	if decrypt {
+		key := make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			c.errorf("diff: error generating hash key: %s", err)
+			return exitTrouble
+		}
+		if leftHashes, err = c.secretHashes(&pf, leftPath, left, key); err != nil {
+			c.errorf("diff: %s", err)
+			return exitTrouble
+		}
+		if rightHashes, err = c.secretHashes(&pf, rightPath, right, key); err != nil {
+			c.errorf("diff: %s", err)
+			return exitTrouble
+		}
+	}
+
+	diffs := diffEnvVars(describe(left, leftHashes), describe(right, rightHashes))
+
+	if format == "json" {
+		err = writeDiffJSON(c.stdout, leftPath, rightPath, diffs)
+	} else {
+		err = writeDiffText(c.stdout, leftPath, rightPath, diffs)
+	}
+	if err != nil {
+		c.errorf("diff: %s", err)
+		return exitTrouble
+	}
+
+	if len(diffs) > 0 {
+		return exitDifferent
+	}
+	return exitOK
+}
+
+// secretHashes decrypts the secrets of the .env file at path and returns their keyed hashes.
+func (c *cli) secretHashes(pf *providerFlags, path string, envVars *envparser.EnvVars,
+	key []byte) (map[string]string, error) {
+	if len(envVars.Secrets) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	ij, err := pf.newInjector(ctx, []string{path})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := ij.Close(); err != nil {
+			c.errorf("diff: %s", err)
+		}
+	}()
+
+	resolved, err := ij.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]string, len(envVars.Secrets))
+	for k := range envVars.Secrets {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(resolved[k])) //nolint:errcheck
+		hashes[k] = hex.EncodeToString(mac.Sum(nil))[:hashLength]
+	}
+
+	return hashes, nil
+}
+
+// describe returns the sides of the keys of envVars.
+func describe(envVars *envparser.EnvVars, hashes map[string]string) map[string]*diffSide {
+	sides := make(map[string]*diffSide, len(envVars.Plain)+len(envVars.Secrets))
+	for k, v := range envVars.Plain {
+		sides[k] = &diffSide{Type: typePlain, Value: v}
+	}
+	for k, v := range envVars.Secrets {
+		ref := "!{" + v + "}"
+		if envVars.Files[k] {
+			ref = "!file{" + v + "}"
+		}
+		sides[k] = &diffSide{Type: typeSecret, Reference: ref, Hash: hashes[k]}
+	}
+
+	return sides
+}
+
+// diffEnvVars returns the differences between the left and right sides, sorted by key.
+// Plain text values are only included when both sides are plain text values that differ.
+func diffEnvVars(left, right map[string]*diffSide) []difference {
+	var diffs []difference
+	for k, l := range left {
+		r, ok := right[k]
+		switch {
+		case !ok:
+			diffs = append(diffs, difference{Key: k, Kind: diffLeftOnly, Left: &diffSide{Type: l.Type, Reference: l.Reference}})
+		case l.Type != r.Type:
+			diffs = append(diffs, difference{
+				Key:   k,
+				Kind:  diffTypeChanged,
+				Left:  &diffSide{Type: l.Type, Reference: l.Reference},
+				Right: &diffSide{Type: r.Type, Reference: r.Reference},
+			})
+		case l.Type == typePlain && l.Value != r.Value:
+			diffs = append(diffs, difference{Key: k, Kind: diffValueChanged, Left: l, Right: r})
+		case l.Type == typeSecret && l.Hash != "" && l.Hash != r.Hash:
+			diffs = append(diffs, difference{Key: k, Kind: diffSecretChanged, Left: l, Right: r})
+		case l.Type == typeSecret && l.Hash == "" && l.Reference != r.Reference:
+			diffs = append(diffs, difference{Key: k, Kind: diffReferenceChanged, Left: l, Right: r})
+		}
+	}
+	for k, r := range right {
+		if _, ok := left[k]; !ok {
+			diffs = append(diffs, difference{
+				Key:   k,
+				Kind:  diffRightOnly,
+				Right: &diffSide{Type: r.Type, Reference: r.Reference},
+			})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Key < diffs[j].Key
+	})
+	return diffs
+}
+
+func writeDiffText(w io.Writer, leftPath, rightPath string, diffs []difference) error {
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", leftPath, rightPath)
+	for _, d := range diffs {
+		switch d.Kind {
+		case diffLeftOnly:
+			fmt.Fprintf(&b, "- %s (%s)\n", d.Key, d.Left)
+		case diffRightOnly:
+			fmt.Fprintf(&b, "+ %s (%s)\n", d.Key, d.Right)
+		case diffValueChanged:
+			fmt.Fprintf(&b, "~ %s: %q -> %q\n", d.Key, d.Left.Value, d.Right.Value)
+		default:
+			fmt.Fprintf(&b, "~ %s: %s -> %s\n", d.Key, d.Left, d.Right)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// String describes the side without its plain text value.
+func (s *diffSide) String() string {
+	switch {
+	case s.Hash != "":
+		return fmt.Sprintf("%s %s hash %s", s.Type, s.Reference, s.Hash)
+	case s.Reference != "":
+		return fmt.Sprintf("%s %s", s.Type, s.Reference)
+	default:
+		return s.Type
+	}
+}
+
+func writeDiffJSON(w io.Writer, leftPath, rightPath string, diffs []difference) error {
+	if diffs == nil {
+		diffs = []difference{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Left        string       `json:"left"`
+		Right       string       `json:"right"`
+		Differences []difference `json:"differences"`
+	}{leftPath, rightPath, diffs})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	stagingEnv = `HOST=staging.local
+PORT=5432
+DEBUG=true
+DB_PASSWORD=!{staging-db-password}
+API_KEY=!{api-key}
+TOKEN=!{token}
+TLS_KEY=!file{tls-key}
+`
+	prodEnv = `HOST=prod.local
+PORT=5432
+DB_PASSWORD=!{prod-db-password}
+API_KEY=!{api-key}
+TOKEN=leaked-token
+TLS_KEY=!file{tls-key}
+REPLICAS=3
+`
+)
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	staging := writeFile(t, dir, "staging.env", stagingEnv, 0600)
+	prod := writeFile(t, dir, "prod.env", prodEnv, 0600)
+
+	tt := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			name:         "differences",
+			args:         []string{"diff", staging, prod},
+			expectedCode: exitDifferent,
+			expectedStdout: "--- " + staging + "\n+++ " + prod + "\n" +
+				"~ DB_PASSWORD: secret !{staging-db-password} -> secret !{prod-db-password}\n" +
+				"- DEBUG (plain)\n" +
+				"~ HOST: \"staging.local\" -> \"prod.local\"\n" +
+				"+ REPLICAS (plain)\n" +
+				"~ TOKEN: secret !{token} -> plain\n",
+		},
+		{
+			name: "same",
+			args: []string{"diff", staging, staging},
+		},
+		{
+			name:           "one file",
+			args:           []string{"diff", staging},
+			expectedCode:   exitTrouble,
+			expectedStderr: "serum: diff: expected two files to compare",
+		},
+		{
+			name:           "missing file",
+			args:           []string{"diff", staging, filepath.Join(dir, "missing.env")},
+			expectedCode:   exitTrouble,
+			expectedStderr: "error opening file",
+		},
+		{
+			name:           "unknown format",
+			args:           []string{"diff", "-format", "yaml", staging, prod},
+			expectedCode:   exitTrouble,
+			expectedStderr: `serum: diff: unknown format "yaml"`,
+		},
+		{
+			name:           "invalid flag",
+			args:           []string{"diff", "-bad", staging, prod},
+			expectedCode:   exitTrouble,
+			expectedStderr: "flag provided but not defined",
+		},
+		{
+			name:           "decrypt without provider",
+			args:           []string{"diff", "-decrypt", staging, prod},
+			expectedCode:   exitTrouble,
+			expectedStderr: "secrets were loaded but the SecretProvider is nil",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, "", tc.args...)
+			assert.Equal(t, code, tc.expectedCode, stderr)
+			assert.Equal(t, stdout, tc.expectedStdout)
+			assert.Assert(t, strings.Contains(stderr, tc.expectedStderr), stderr)
+		})
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	dir := t.TempDir()
+	staging := writeFile(t, dir, "staging.env", stagingEnv, 0600)
+	prod := writeFile(t, dir, "prod.env", prodEnv, 0600)
+
+	code, stdout, stderr := runCLI(t, "", "diff", "-format", "json", staging, prod)
+	assert.Equal(t, code, exitDifferent, stderr)
+	assert.Assert(t, !strings.Contains(stdout, "leaked-token"))
+
+	var out struct {
+		Left        string       `json:"left"`
+		Right       string       `json:"right"`
+		Differences []difference `json:"differences"`
+	}
+	assert.NilError(t, json.Unmarshal([]byte(stdout), &out))
+	assert.Equal(t, out.Left, staging)
+	assert.Equal(t, out.Right, prod)
+	assert.DeepEqual(t, out.Differences, []difference{
+		{
+			Key:   "DB_PASSWORD",
+			Kind:  diffReferenceChanged,
+			Left:  &diffSide{Type: typeSecret, Reference: "!{staging-db-password}"},
+			Right: &diffSide{Type: typeSecret, Reference: "!{prod-db-password}"},
+		},
+		{Key: "DEBUG", Kind: diffLeftOnly, Left: &diffSide{Type: typePlain}},
+		{
+			Key:   "HOST",
+			Kind:  diffValueChanged,
+			Left:  &diffSide{Type: typePlain, Value: "staging.local"},
+			Right: &diffSide{Type: typePlain, Value: "prod.local"},
+		},
+		{Key: "REPLICAS", Kind: diffRightOnly, Right: &diffSide{Type: typePlain}},
+		{
+			Key:   "TOKEN",
+			Kind:  diffTypeChanged,
+			Left:  &diffSide{Type: typeSecret, Reference: "!{token}"},
+			Right: &diffSide{Type: typePlain},
+		},
+	})
+
+	code, stdout, _ = runCLI(t, "", "diff", "-format", "json", staging, staging)
+	assert.Equal(t, code, exitOK)
+	assert.Assert(t, strings.Contains(stdout, `"differences": []`), stdout)
+}
+
+func TestDiffDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	staging := writeFile(t, dir, "staging.env", "DB_PASSWORD=!{staging-db-password}\nAPI_KEY=!{staging-api-key}\n", 0600)
+	prod := writeFile(t, dir, "prod.env", "DB_PASSWORD=!{prod-db-password}\nAPI_KEY=!{prod-api-key}\n", 0600)
+	// api keys decrypt to the same value in both environments
+	plugin := writeFile(t, dir, "plugin.sh", `#!/bin/sh
+case "$1" in
+	*api-key) printf 'shared-api-key' ;;
+	*) printf 'password-%s' "$1" ;;
+esac
+`, 0700)
+
+	code, stdout, stderr := runCLI(t, "", "diff", "-decrypt", "-provider", "exec", "-exec-command", plugin, staging, prod)
+	assert.Equal(t, code, exitDifferent, stderr)
+	assert.Assert(t, !strings.Contains(stdout, "password-"), stdout)
+	assert.Assert(t, regexp.MustCompile(`^--- .+\n\+\+\+ .+\n`+
+		`~ DB_PASSWORD: secret !\{staging-db-password\} hash [0-9a-f]{12} -> `+
+		`secret !\{prod-db-password\} hash [0-9a-f]{12}\n$`).
+		MatchString(stdout), stdout)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wingocard/serum/envfile"
+)
+
+// set adds, updates or deletes a key of a .env file, keeping the rest of the file as is.
+func (c *cli) set(args []string) int {
+	var (
+		envFile    string
+		secret     bool
+		fileSecret bool
+		del        bool
+	)
+	fs := c.flagSet("set")
+	fs.StringVar(&envFile, "env-file", defaultEnvFile, "`path` of the .env file to edit")
+	fs.BoolVar(&secret, "secret", false, "write the value as a secret reference, !{value}")
+	fs.BoolVar(&fileSecret, "file-secret", false, "write the value as a secret file reference, !file{value}")
+	fs.BoolVar(&del, "delete", false, "delete the key")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	switch {
+	case secret && fileSecret:
+		c.errorf("set: -secret and -file-secret can not be used together")
+		return exitUsage
+	case del && fs.NArg() != 1:
+		c.errorf("set: expected a key to delete")
+		return exitUsage
+	case fs.NArg() < 1 || fs.NArg() > 2:
+		c.errorf("set: expected a key and an optional value")
+		fs.Usage()
+		return exitUsage
+	}
+	key := fs.Arg(0)
+
+	doc, err := readDocument(envFile, !del)
+	if err != nil {
+		c.errorf("set: %s", err)
+		return exitError
+	}
+
+	if del {
+		if !doc.Delete(key) {
+			c.errorf("set: %s is not defined in %s", key, envFile)
+			return exitError
+		}
+	} else {
+		value, err := c.value(fs.Args())
+		if err != nil {
+			c.errorf("set: %s", err)
+			return exitError
+		}
+		switch {
+		case secret:
+			value = "!{" + value + "}"
+		case fileSecret:
+			value = "!file{" + value + "}"
+		}
+
+		if err := doc.Set(key, value); err != nil {
+			c.errorf("set: %s", err)
+			return exitError
+		}
+	}
+
+	if err := writeFileAtomic(envFile, doc.Bytes()); err != nil {
+		c.errorf("set: %s", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// value returns the value argument, or reads it from stdin when it is omitted so values
+// don't end up in the shell's history. A single trailing newline is removed.
+func (c *cli) value(args []string) (string, error) {
+	if len(args) == 2 {
+		return args[1], nil
+	}
+
+	data, err := ioutil.ReadAll(bufio.NewReader(c.stdin))
+	if err != nil {
+		return "", fmt.Errorf("error reading value from stdin: %w", err)
+	}
+
+	v := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(v, "\r"), nil
+}
+
+// get prints the value of a key as it is written in a .env file, without decrypting it.
+func (c *cli) get(args []string) int {
+	var envFile string
+	fs := c.flagSet("get")
+	fs.StringVar(&envFile, "env-file", defaultEnvFile, "`path` of the .env file to read")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if fs.NArg() != 1 {
+		c.errorf("get: expected a key")
+		fs.Usage()
+		return exitUsage
+	}
+
+	doc, err := readDocument(envFile, false)
+	if err != nil {
+		c.errorf("get: %s", err)
+		return exitError
+	}
+
+	e, ok := doc.Get(fs.Arg(0))
+	if !ok {
+		c.errorf("get: %s is not defined in %s", fs.Arg(0), envFile)
+		return exitError
+	}
+
+	fmt.Fprintln(c.stdout, e.Value)
+	return exitOK
+}
+
+// readDocument parses the .env file at path. When create is true a missing file
+// is read as an empty file.
+func readDocument(path string, create bool) (*envfile.Document, error) {
+	doc, err := envfile.ParseFile(path)
+	if errors.Is(err, os.ErrNotExist) && create {
+		return envfile.Parse(bytes.NewReader(nil))
+	}
+
+	return doc, err
+}
+
+// writeFileAtomic replaces the file at path with data by renaming a temporary file, keeping
+// the permissions of the existing file. New files are created with 0600 permissions.
+func writeFileAtomic(path string, data []byte) error {
+	perm := os.FileMode(0600)
+	if fi, err := os.Stat(path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	if err := writeAndClose(f, data, perm); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func writeAndClose(f *os.File, data []byte, perm os.FileMode) error {
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const editEnvFile = `# database
+DB_HOST = localhost
+DB_PASSWORD=hunter2
+
+# keys
+JWT_KEY="line1
+line2"
+`
+
+func TestSet(t *testing.T) {
+	tt := []struct {
+		name           string
+		args           []string
+		stdin          string
+		expectedCode   int
+		expected       string
+		expectedStderr string
+	}{
+		{
+			name:     "update",
+			args:     []string{"DB_HOST", "127.0.0.1"},
+			expected: strings.Replace(editEnvFile, "DB_HOST = localhost", "DB_HOST = 127.0.0.1", 1),
+		},
+		{
+			name:     "add",
+			args:     []string{"DB_PORT", "5432"},
+			expected: editEnvFile + "DB_PORT=5432\n",
+		},
+		{
+			name:     "convert to secret",
+			args:     []string{"-secret", "DB_PASSWORD", "projects/p/secrets/db-password"},
+			expected: strings.Replace(editEnvFile, "hunter2", "!{projects/p/secrets/db-password}", 1),
+		},
+		{
+			name:     "convert to file secret",
+			args:     []string{"-file-secret", "JWT_KEY", "jwt-key"},
+			expected: strings.Replace(editEnvFile, "\"line1\nline2\"", "!file{jwt-key}", 1),
+		},
+		{
+			name:     "value from stdin",
+			args:     []string{"JWT_KEY"},
+			stdin:    "new1\nnew2\n",
+			expected: strings.Replace(editEnvFile, "line1\nline2", "new1\nnew2", 1),
+		},
+		{
+			name:     "delete",
+			args:     []string{"-delete", "JWT_KEY"},
+			expected: "# database\nDB_HOST = localhost\nDB_PASSWORD=hunter2\n\n# keys\n",
+		},
+		{
+			name:           "delete missing key",
+			args:           []string{"-delete", "MISSING"},
+			expectedCode:   exitError,
+			expected:       editEnvFile,
+			expectedStderr: "serum: set: MISSING is not defined in",
+		},
+		{
+			name:           "invalid value",
+			args:           []string{"DB_HOST", " localhost"},
+			expectedCode:   exitError,
+			expected:       editEnvFile,
+			expectedStderr: "serum: set: envfile: value of DB_HOST can not be written to a .env file",
+		},
+		{
+			name:           "no key",
+			expectedCode:   exitUsage,
+			expected:       editEnvFile,
+			expectedStderr: "serum: set: expected a key and an optional value",
+		},
+		{
+			name:           "delete with value",
+			args:           []string{"-delete", "DB_HOST", "value"},
+			expectedCode:   exitUsage,
+			expected:       editEnvFile,
+			expectedStderr: "serum: set: expected a key to delete",
+		},
+		{
+			name:           "secret and file secret",
+			args:           []string{"-secret", "-file-secret", "DB_PASSWORD", "ref"},
+			expectedCode:   exitUsage,
+			expected:       editEnvFile,
+			expectedStderr: "can not be used together",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			env := writeFile(t, t.TempDir(), ".env", editEnvFile, 0640)
+
+			code, stdout, stderr := runCLI(t, tc.stdin, append([]string{"set", "-env-file", env}, tc.args...)...)
+			assert.Equal(t, code, tc.expectedCode, stderr)
+			assert.Equal(t, stdout, "")
+			assert.Assert(t, strings.Contains(stderr, tc.expectedStderr), stderr)
+
+			data, err := ioutil.ReadFile(env)
+			assert.NilError(t, err)
+			assert.Equal(t, string(data), tc.expected)
+
+			fi, err := os.Stat(env)
+			assert.NilError(t, err)
+			assert.Equal(t, fi.Mode().Perm(), os.FileMode(0640))
+
+			entries, err := ioutil.ReadDir(filepath.Dir(env))
+			assert.NilError(t, err)
+			assert.Equal(t, len(entries), 1)
+		})
+	}
+}
+
+func TestSetNewFile(t *testing.T) {
+	env := filepath.Join(t.TempDir(), ".env")
+
+	code, _, stderr := runCLI(t, "", "set", "-env-file", env, "-secret", "DB_PASSWORD", "db-password")
+	assert.Equal(t, code, exitOK, stderr)
+
+	data, err := ioutil.ReadFile(env)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "DB_PASSWORD=!{db-password}\n")
+
+	fi, err := os.Stat(env)
+	assert.NilError(t, err)
+	assert.Equal(t, fi.Mode().Perm(), os.FileMode(0600))
+}
+
+func TestSetInvalidFile(t *testing.T) {
+	env := writeFile(t, t.TempDir(), ".env", "BAD_VALUE\n", 0600)
+
+	code, _, stderr := runCLI(t, "", "set", "-env-file", env, "KEY", "value")
+	assert.Equal(t, code, exitError)
+	assert.Assert(t, strings.Contains(stderr, "syntax error at line 1"), stderr)
+}
+
+func TestGet(t *testing.T) {
+	dir := t.TempDir()
+	env := writeFile(t, dir, ".env", editEnvFile+"SECRET=!{db-password}\n", 0600)
+
+	tt := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			name:           "plain",
+			args:           []string{"-env-file", env, "DB_HOST"},
+			expectedStdout: "localhost\n",
+		},
+		{
+			name:           "multiline",
+			args:           []string{"-env-file", env, "JWT_KEY"},
+			expectedStdout: "line1\nline2\n",
+		},
+		{
+			name:           "secret",
+			args:           []string{"-env-file", env, "SECRET"},
+			expectedStdout: "!{db-password}\n",
+		},
+		{
+			name:           "missing key",
+			args:           []string{"-env-file", env, "MISSING"},
+			expectedCode:   exitError,
+			expectedStderr: "serum: get: MISSING is not defined in " + env,
+		},
+		{
+			name:           "missing file",
+			args:           []string{"-env-file", filepath.Join(dir, "missing.env"), "KEY"},
+			expectedCode:   exitError,
+			expectedStderr: "no such file or directory",
+		},
+		{
+			name:           "no key",
+			args:           []string{"-env-file", env},
+			expectedCode:   exitUsage,
+			expectedStderr: "serum: get: expected a key",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, "", append([]string{"get"}, tc.args...)...)
+			assert.Equal(t, code, tc.expectedCode, stderr)
+			assert.Equal(t, stdout, tc.expectedStdout)
+			assert.Assert(t, strings.Contains(stderr, tc.expectedStderr), stderr)
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/wingocard/serum/internal/envparser"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	shellNameRe   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	k8sDataKeyRe  = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+	systemdEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+)
+
+// envVar is a key/value pair to export.
+type envVar struct {
+	key   string
+	value string
+}
+
+// exporter writes env vars in the format of another tool.
+type exporter func(w io.Writer, vars []envVar) error
+
+// export writes the env vars of .env files in a format other tools can read.
+func (c *cli) export(args []string) int {
+	var (
+		envFiles  stringsFlag
+		pf        providerFlags
+		format    string
+		output    string
+		appendOut bool
+		noDecrypt bool
+		name      string
+		namespace string
+	)
+	fs := c.flagSet("export")
+	fs.Var(&envFiles, "env-file", "`path` of a .env file, can be repeated to layer files (default .env)")
+	fs.StringVar(&format, "format", "shell", "output format: docker, github, systemd, k8s or shell")
+	fs.StringVar(&output, "o", "", "write to the file at `path` instead of stdout, created with 0600 permissions")
+	fs.BoolVar(&appendOut, "append", false, "append to the -o file instead of truncating it, e.g. for $GITHUB_ENV")
+	fs.BoolVar(&noDecrypt, "no-decrypt", false, "export secrets as !{...} references instead of decrypting them")
+	fs.StringVar(&name, "name", "serum", "k8s: name of the Secret")
+	fs.StringVar(&namespace, "namespace", "", "k8s: namespace of the Secret")
+	pf.register(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	var exp exporter
+	switch format {
+	case "docker":
+		exp = exportDocker
+	case "github":
+		exp = exportGitHub
+	case "systemd":
+		exp = exportSystemd
+	case "k8s":
+		exp = exportK8sSecret(name, namespace)
+	case "shell":
+		exp = exportShell
+	default:
+		c.errorf("export: unknown format %q", format)
+		return exitUsage
+	}
+	if len(envFiles) == 0 {
+		envFiles = stringsFlag{defaultEnvFile}
+	}
+
+	var (
+		vars       []envVar
+		hasSecrets bool
+		err        error
+	)
+	if noDecrypt {
+		vars, err = loadReferences(envFiles)
+	} else {
+		vars, hasSecrets, err = c.resolve(&pf, envFiles)
+	}
+	if err != nil {
+		c.errorf("export: %s", err)
+		return exitError
+	}
+
+	w := c.stdout
+	if output != "" {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if appendOut {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(output, flags, 0600)
+		if err != nil {
+			c.errorf("export: %s", err)
+			return exitError
+		}
+		defer f.Close()
+		w = f
+	} else if hasSecrets {
+		c.errorf("export: warning: decrypted secrets are written to stdout, use -o to write them to a file")
+	}
+
+	if err := exp(w, vars); err != nil {
+		c.errorf("export: %s", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// resolve returns the env vars of the .env files with their secrets decrypted, sorted by key,
+// and whether any secrets were decrypted.
+func (c *cli) resolve(pf *providerFlags, envFiles []string) ([]envVar, bool, error) {
+	refs, err := loadEnvFiles(envFiles)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ctx := context.Background()
+	ij, err := pf.newInjector(ctx, envFiles)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		if err := ij.Close(); err != nil {
+			c.errorf("export: %s", err)
+		}
+	}()
+
+	resolved, err := ij.Resolve(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return sortedVars(resolved), len(refs.Secrets) > 0, nil
+}
+
+// loadEnvFiles parses and merges the layered .env files.
+func loadEnvFiles(envFiles []string) (*envparser.EnvVars, error) {
+	envVars := &envparser.EnvVars{
+		Plain:   make(map[string]string),
+		Secrets: make(map[string]string),
+	}
+	for _, path := range envFiles {
+		layer, err := envparser.ParseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		envVars.Merge(layer)
+	}
+
+	return envVars, nil
+}
+
+// loadReferences returns the env vars of the .env files with their secrets as !{...}
+// references, sorted by key.
+func loadReferences(envFiles []string) ([]envVar, error) {
+	envVars, err := loadEnvFiles(envFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(envVars.Plain)+len(envVars.Secrets))
+	for k, v := range envVars.Plain {
+		values[k] = v
+	}
+	for k, v := range envVars.Secrets {
+		if envVars.Files[k] {
+			values[k] = "!file{" + v + "}"
+			continue
+		}
+		values[k] = "!{" + v + "}"
+	}
+
+	return sortedVars(values), nil
+}
+
+func sortedVars(values map[string]string) []envVar {
+	vars := make([]envVar, 0, len(values))
+	for k, v := range values {
+		vars = append(vars, envVar{key: k, value: v})
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].key < vars[j].key
+	})
+
+	return vars
+}
+
+// exportDocker writes a docker --env-file. Docker reads values as is, so they can not contain newlines.
+func exportDocker(w io.Writer, vars []envVar) error {
+	var b strings.Builder
+	for _, v := range vars {
+		if strings.ContainsAny(v.value, "\r\n") {
+			return fmt.Errorf("value of %s contains a newline, which docker env files do not support", v.key)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", v.key, v.value)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// exportGitHub writes env vars in the $GITHUB_ENV format of GitHub Actions. Multiline values
+// use a heredoc with a random delimiter.
+func exportGitHub(w io.Writer, vars []envVar) error {
+	var b strings.Builder
+	for _, v := range vars {
+		if !strings.ContainsAny(v.value, "\r\n") {
+			fmt.Fprintf(&b, "%s=%s\n", v.key, v.value)
+			continue
+		}
+
+		delim, err := heredocDelimiter(v.value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s<<%s\n%s\n%s\n", v.key, delim, v.value, delim)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// heredocDelimiter returns a random delimiter that is not contained in value.
+func heredocDelimiter(value string) (string, error) {
+	for {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("error generating heredoc delimiter: %w", err)
+		}
+
+		delim := "ghadelimiter_" + hex.EncodeToString(buf)
+		if !strings.Contains(value, delim) {
+			return delim, nil
+		}
+	}
+}
+
+// exportSystemd writes a systemd EnvironmentFile. Values are double quoted, which preserves
+// newlines, and the characters systemd unescapes within double quotes are escaped.
+func exportSystemd(w io.Writer, vars []envVar) error {
+	var b strings.Builder
+	for _, v := range vars {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", v.key, systemdEscape.Replace(v.value))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// exportShell writes a POSIX shell script exporting the env vars. Values are single quoted
+// so they are never expanded.
+func exportShell(w io.Writer, vars []envVar) error {
+	var b strings.Builder
+	for _, v := range vars {
+		if !shellNameRe.MatchString(v.key) {
+			return fmt.Errorf("%s is not a valid shell variable name", v.key)
+		}
+		fmt.Fprintf(&b, "export %s='%s'\n", v.key, strings.ReplaceAll(v.value, "'", `'\''`))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type k8sSecret struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data"`
+}
+
+type k8sMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// exportK8sSecret returns an exporter that writes a Kubernetes Secret manifest with the
+// base64 encoded env vars as its data.
+func exportK8sSecret(name, namespace string) exporter {
+	return func(w io.Writer, vars []envVar) error {
+		s := k8sSecret{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata:   k8sMetadata{Name: name, Namespace: namespace},
+			Type:       "Opaque",
+			Data:       make(map[string]string, len(vars)),
+		}
+		for _, v := range vars {
+			if !k8sDataKeyRe.MatchString(v.key) {
+				return fmt.Errorf("%s is not a valid Secret key", v.key)
+			}
+			s.Data[v.key] = base64.StdEncoding.EncodeToString([]byte(v.value))
+		}
+
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+}
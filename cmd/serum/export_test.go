@@ -0,0 +1,196 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const exportEnvFile = `HOST=localhost
+QUOTES=it's "quoted"
+SPECIAL=$HOME \n ` + "`id`" + `
+`
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	env := writeFile(t, dir, ".env", exportEnvFile, 0600)
+	multiline := writeFile(t, dir, "multiline.env", "KEY=\"line1\nline2\"\n", 0600)
+	secrets := writeFile(t, dir, "secrets.env", "HOST=localhost\nPASSWORD=!{db-password}\nTLS_KEY=!file{tls-key}\n", 0600)
+	plugin := writeFile(t, dir, "plugin.sh", "#!/bin/sh\nprintf 'decrypted-%s' \"$1\"\n", 0700)
+	colon := writeFile(t, dir, "colon.env", "app:name=serum\n", 0600)
+
+	tt := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			name: "shell",
+			args: []string{"export", "-env-file", env},
+			expectedStdout: "export HOST='localhost'\n" +
+				"export QUOTES='it'\\''s \"quoted\"'\n" +
+				"export SPECIAL='$HOME \\n `id`'\n",
+		},
+		{
+			name: "docker",
+			args: []string{"export", "-format", "docker", "-env-file", env},
+			expectedStdout: "HOST=localhost\n" +
+				"QUOTES=it's \"quoted\"\n" +
+				"SPECIAL=$HOME \\n `id`\n",
+		},
+		{
+			name:           "docker multiline",
+			args:           []string{"export", "-format", "docker", "-env-file", multiline},
+			expectedCode:   exitError,
+			expectedStderr: "value of KEY contains a newline",
+		},
+		{
+			name: "systemd",
+			args: []string{"export", "-format", "systemd", "-env-file", env, "-env-file", multiline},
+			expectedStdout: "HOST=\"localhost\"\n" +
+				"KEY=\"line1\nline2\"\n" +
+				"QUOTES=\"it's \\\"quoted\\\"\"\n" +
+				"SPECIAL=\"\\$HOME \\\\n \\`id\\`\"\n",
+		},
+		{
+			name: "github",
+			args: []string{"export", "-format", "github", "-env-file", env},
+			expectedStdout: "HOST=localhost\n" +
+				"QUOTES=it's \"quoted\"\n" +
+				"SPECIAL=$HOME \\n `id`\n",
+		},
+		{
+			name: "k8s",
+			args: []string{"export", "-format", "k8s", "-name", "app", "-namespace", "prod", "-env-file", env},
+			expectedStdout: `apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+  namespace: prod
+type: Opaque
+data:
+  HOST: bG9jYWxob3N0
+  QUOTES: aXQncyAicXVvdGVkIg==
+  SPECIAL: JEhPTUUgXG4gYGlkYA==
+`,
+		},
+		{
+			name: "decrypted secrets to stdout",
+			args: []string{"export", "-format", "docker", "-env-file", secrets,
+				"-provider", "exec", "-exec-command", plugin},
+			expectedStdout: "HOST=localhost\nPASSWORD=decrypted-db-password\nTLS_KEY=decrypted-tls-key\n",
+			expectedStderr: "serum: export: warning: decrypted secrets are written to stdout",
+		},
+		{
+			name:           "no decrypt",
+			args:           []string{"export", "-format", "docker", "-no-decrypt", "-env-file", secrets},
+			expectedStdout: "HOST=localhost\nPASSWORD=!{db-password}\nTLS_KEY=!file{tls-key}\n",
+		},
+		{
+			name:           "secrets without provider",
+			args:           []string{"export", "-env-file", secrets},
+			expectedCode:   exitError,
+			expectedStderr: "secrets were loaded but the SecretProvider is nil",
+		},
+		{
+			name:           "invalid shell name",
+			args:           []string{"export", "-env-file", writeFile(t, dir, "dots.env", "app.name=serum\n", 0600)},
+			expectedCode:   exitError,
+			expectedStderr: "app.name is not a valid shell variable name",
+		},
+		{
+			name:           "invalid k8s key",
+			args:           []string{"export", "-format", "k8s", "-env-file", colon},
+			expectedCode:   exitError,
+			expectedStderr: "app:name is not a valid Secret key",
+		},
+		{
+			name:           "missing env file",
+			args:           []string{"export", "-no-decrypt", "-env-file", filepath.Join(dir, "missing.env")},
+			expectedCode:   exitError,
+			expectedStderr: "error opening file",
+		},
+		{
+			name:           "unknown format",
+			args:           []string{"export", "-format", "toml", "-env-file", env},
+			expectedCode:   exitUsage,
+			expectedStderr: `serum: export: unknown format "toml"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, "", tc.args...)
+			assert.Equal(t, code, tc.expectedCode, stderr)
+			assert.Equal(t, stdout, tc.expectedStdout)
+			if tc.expectedStderr == "" {
+				assert.Equal(t, stderr, "")
+				return
+			}
+			assert.Assert(t, strings.Contains(stderr, tc.expectedStderr), stderr)
+		})
+	}
+}
+
+func TestExportGitHubMultiline(t *testing.T) {
+	env := writeFile(t, t.TempDir(), ".env", "HOST=localhost\nKEY=\"line1\nline2\"\n", 0600)
+
+	code, stdout, stderr := runCLI(t, "", "export", "-format", "github", "-env-file", env)
+	assert.Equal(t, code, exitOK, stderr)
+	expected := regexp.MustCompile(
+		"^HOST=localhost\nKEY<<(ghadelimiter_[0-9a-f]{32})\nline1\nline2\n(ghadelimiter_[0-9a-f]{32})\n$")
+	assert.Assert(t, expected.MatchString(stdout), stdout)
+
+	delims := regexp.MustCompile("ghadelimiter_[0-9a-f]{32}").FindAllString(stdout, -1)
+	assert.Equal(t, delims[0], delims[1])
+}
+
+func TestExportShellRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	env := writeFile(t, dir, ".env", exportEnvFile+"KEY=\"line1\nline2\"\n", 0600)
+	script := filepath.Join(dir, "env.sh")
+
+	code, stdout, stderr := runCLI(t, "", "export", "-env-file", env, "-o", script)
+	assert.Equal(t, code, exitOK, stderr)
+	assert.Equal(t, stdout, "")
+
+	out, err := osexec.Command("sh", "-c", `. "$0"; printf '%s|%s|%s' "$QUOTES" "$SPECIAL" "$KEY"`, script).Output()
+	assert.NilError(t, err)
+	assert.Equal(t, string(out), "it's \"quoted\"|$HOME \\n `id`|line1\nline2")
+}
+
+func TestExportOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	secrets := writeFile(t, dir, "secrets.env", "PASSWORD=!{db-password}\n", 0600)
+	plugin := writeFile(t, dir, "plugin.sh", "#!/bin/sh\nprintf 'decrypted-%s' \"$1\"\n", 0700)
+	githubEnv := writeFile(t, dir, "github_env", "EXISTING=value\n", 0644)
+	output := filepath.Join(dir, "out.env")
+
+	code, stdout, stderr := runCLI(t, "", "export", "-format", "docker", "-env-file", secrets,
+		"-provider", "exec", "-exec-command", plugin, "-o", output)
+	assert.Equal(t, code, exitOK, stderr)
+	assert.Equal(t, stdout, "")
+	assert.Equal(t, stderr, "")
+
+	fi, err := os.Stat(output)
+	assert.NilError(t, err)
+	assert.Equal(t, fi.Mode().Perm(), os.FileMode(0600))
+	data, err := ioutil.ReadFile(output)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "PASSWORD=decrypted-db-password\n")
+
+	code, _, stderr = runCLI(t, "", "export", "-format", "github", "-env-file", secrets,
+		"-provider", "exec", "-exec-command", plugin, "-o", githubEnv, "-append")
+	assert.Equal(t, code, exitOK, stderr)
+	data, err = ioutil.ReadFile(githubEnv)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "EXISTING=value\nPASSWORD=decrypted-db-password\n")
+}
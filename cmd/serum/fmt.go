@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/wingocard/serum/envfile"
+	"github.com/wingocard/serum/internal/envparser"
+)
+
+const diffContext = 3
+
+// fmtCmd formats .env files. By default the formatted files are printed to stdout.
+func (c *cli) fmtCmd(args []string) int {
+	var (
+		list     bool
+		diff     bool
+		write    bool
+		sortKeys bool
+	)
+	fs := c.flagSet("fmt")
+	fs.BoolVar(&list, "l", false, "list the files whose formatting differs")
+	fs.BoolVar(&diff, "d", false, "print the diffs of the files whose formatting differs")
+	fs.BoolVar(&write, "w", false, "write the formatted files back")
+	fs.BoolVar(&sortKeys, "sort", false, "sort keys within sections delimited by comments or blank lines")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{defaultEnvFile}
+	}
+
+	code := exitOK
+	for _, path := range files {
+		if err := c.fmtFile(path, list, diff, write, sortKeys); err != nil {
+			c.errorf("fmt: %s", err)
+			code = exitError
+		}
+	}
+
+	return code
+}
+
+func (c *cli) fmtFile(path string, list, diff, write, sortKeys bool) error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	res, err := formatEnvFile(src, sortKeys)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if !list && !diff && !write {
+		_, err := c.stdout.Write(res)
+		return err
+	}
+
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	if list {
+		fmt.Fprintln(c.stdout, path)
+	}
+	if diff {
+		fmt.Fprint(c.stdout, unifiedDiff(path, src, res))
+	}
+	if write {
+		return writeFileAtomic(path, res)
+	}
+
+	return nil
+}
+
+// formatEnvFile returns the canonical formatting of the .env file src: entries are written as KEY=value
+// without indentation, multiline values are the only values written double quoted, comments and
+// blank lines are trimmed, consecutive blank lines are merged and the file ends with a single
+// newline. It returns an error if the formatted file would not parse to the same env vars.
+func formatEnvFile(src []byte, sortKeys bool) ([]byte, error) {
+	doc, err := envfile.Parse(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+
+	nl := doc.Newline
+	var nodes []envfile.Node
+	for _, n := range doc.Nodes {
+		switch n := n.(type) {
+		case *envfile.Entry:
+			quote := envfile.QuoteNone
+			if strings.Contains(n.Value, "\n") {
+				quote = envfile.QuoteDouble
+			}
+			nodes = append(nodes, &envfile.Entry{
+				Position:   n.Position,
+				Key:        n.Key,
+				Separator:  "=",
+				Value:      n.Value,
+				Quote:      quote,
+				LineEnding: nl,
+			})
+		case *envfile.Comment:
+			nodes = append(nodes, &envfile.Comment{Position: n.Position, Text: strings.TrimSpace(n.Text), LineEnding: nl})
+		case *envfile.Blank:
+			// skip leading and consecutive blank lines
+			if len(nodes) == 0 {
+				continue
+			}
+			if _, ok := nodes[len(nodes)-1].(*envfile.Blank); ok {
+				continue
+			}
+			nodes = append(nodes, &envfile.Blank{Position: n.Position, LineEnding: nl})
+		}
+	}
+
+	// skip trailing blank lines
+	for len(nodes) > 0 {
+		if _, ok := nodes[len(nodes)-1].(*envfile.Blank); !ok {
+			break
+		}
+		nodes = nodes[:len(nodes)-1]
+	}
+
+	if sortKeys {
+		sortSections(nodes)
+	}
+
+	formatted := &envfile.Document{Nodes: nodes, Newline: nl}
+	res := formatted.Bytes()
+	if err := verifyFormat(src, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// sortSections sorts the runs of consecutive entries of nodes by key. The sort is stable, so
+// the last definition of a key defined more than once stays the last.
+func sortSections(nodes []envfile.Node) {
+	start := 0
+	for i := 0; i <= len(nodes); i++ {
+		if i < len(nodes) {
+			if _, ok := nodes[i].(*envfile.Entry); ok {
+				continue
+			}
+		}
+
+		section := nodes[start:i]
+		sort.SliceStable(section, func(a, b int) bool {
+			return section[a].(*envfile.Entry).Key < section[b].(*envfile.Entry).Key
+		})
+		start = i + 1
+	}
+}
+
+// verifyFormat returns an error if the formatted file res does not parse to the same env vars
+// as src. Values are not included in the error.
+func verifyFormat(src, res []byte) error {
+	before, err := envparser.Parse(bytes.NewReader(src))
+	if err != nil {
+		return err
+	}
+	after, err := envparser.Parse(bytes.NewReader(res))
+	if err != nil {
+		return fmt.Errorf("formatted file can not be parsed: %w", err)
+	}
+
+	for _, vars := range []struct{ before, after interface{} }{
+		{before.Plain, after.Plain},
+		{before.Secrets, after.Secrets},
+		{before.Files, after.Files},
+	} {
+		if !reflect.DeepEqual(vars.before, vars.after) {
+			return fmt.Errorf("formatting would change the parsed values")
+		}
+	}
+
+	return nil
+}
+
+// diffOp is a line of a diff, kind is ' ' for unchanged lines, '-' for removed lines and '+'
+// for added lines. a and b are the indexes of the line in the old and the new file.
+type diffOp struct {
+	kind byte
+	line string
+	a, b int
+}
+
+// unifiedDiff returns the unified diff of the old and new contents of the file at path.
+func unifiedDiff(path string, old, new []byte) string {
+	ops := diffLines(splitDiffLines(old), splitDiffLines(new))
+
+	// group the changes with their context into hunks of ops[start:end]
+	var hunks [][2]int
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+
+		start, end := i-diffContext, i+diffContext+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(ops) {
+			end = len(ops)
+		}
+		if n := len(hunks); n > 0 && start <= hunks[n-1][1] {
+			hunks[n-1][1] = end
+			continue
+		}
+		hunks = append(hunks, [2]int{start, end})
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", path, path)
+	for _, h := range hunks {
+		hunk := ops[h[0]:h[1]]
+		oldLines, newLines := 0, 0
+		for _, op := range hunk {
+			if op.kind != '+' {
+				oldLines++
+			}
+			if op.kind != '-' {
+				newLines++
+			}
+		}
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(hunk[0].a, oldLines), hunkRange(hunk[0].b, newLines))
+		for _, op := range hunk {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, lines)
+}
+
+// diffLines returns the ops turning a into b, using their longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{kind: ' ', line: a[i], a: i, b: j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{kind: '-', line: a[i], a: i, b: j})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', line: b[j], a: i, b: j})
+			j++
+		}
+	}
+
+	return ops
+}
+
+// splitDiffLines splits data into lines that keep their line endings.
+func splitDiffLines(data []byte) []string {
+	var lines []string
+	for s := string(data); s != ""; {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+
+	return lines
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const unformattedEnvFile = `
+
+  # database   
+DB_PORT = 5432
+  DB_HOST=localhost  
+
+
+DB_PASSWORD =!{db-password}
+#DEBUG=true
+JWT_KEY = "line1
+    line2
+
+# skipped by the parser
+line3"
+CERT=!file{tls#.cert}
+
+`
+
+const formattedEnvFile = `# database
+DB_PORT=5432
+DB_HOST=localhost
+
+DB_PASSWORD=!{db-password}
+#DEBUG=true
+JWT_KEY="line1
+line2
+line3"
+CERT=!file{tls#.cert}
+`
+
+func TestFormatEnvFile(t *testing.T) {
+	tt := []struct {
+		name     string
+		src      string
+		sortKeys bool
+		expected string
+	}{
+		{name: "format", src: unformattedEnvFile, expected: formattedEnvFile},
+		{name: "formatted", src: formattedEnvFile, expected: formattedEnvFile},
+		{
+			name:     "sort",
+			src:      unformattedEnvFile,
+			sortKeys: true,
+			expected: `# database
+DB_HOST=localhost
+DB_PORT=5432
+
+DB_PASSWORD=!{db-password}
+#DEBUG=true
+CERT=!file{tls#.cert}
+JWT_KEY="line1
+line2
+line3"
+`,
+		},
+		{
+			name:     "sort keeps the last definition last",
+			src:      "B=1\nA=1\nB=2\n",
+			sortKeys: true,
+			expected: "A=1\nB=1\nB=2\n",
+		},
+		{name: "trailing newline", src: "A=1", expected: "A=1\n"},
+		{name: "crlf", src: "A = 1\r\n\r\n\r\nB=2", expected: "A=1\r\n\r\nB=2\r\n"},
+		{name: "quoted single line value", src: `A = "quoted"`, expected: "A=\"quoted\"\n"},
+		{name: "empty", src: "", expected: ""},
+		{name: "blank lines only", src: "\n\n", expected: ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := formatEnvFile([]byte(tc.src), tc.sortKeys)
+			assert.NilError(t, err)
+			assert.Equal(t, string(res), tc.expected)
+
+			// formatting is idempotent
+			again, err := formatEnvFile(res, tc.sortKeys)
+			assert.NilError(t, err)
+			assert.Equal(t, string(again), string(res))
+		})
+	}
+}
+
+func TestFormatEnvFileError(t *testing.T) {
+	_, err := formatEnvFile([]byte("A=1\nBAD_VALUE\n"), false)
+	assert.ErrorContains(t, err, `invalid format "BAD_VALUE"`)
+
+	err = verifyFormat([]byte("A=1\nB=!{b}\n"), []byte("A=1\nB=b\n"))
+	assert.ErrorContains(t, err, "formatting would change the parsed values")
+}
+
+func TestFmt(t *testing.T) {
+	dir := t.TempDir()
+	unformatted := writeFile(t, dir, "unformatted.env", unformattedEnvFile, 0640)
+	formatted := writeFile(t, dir, "formatted.env", formattedEnvFile, 0600)
+
+	code, stdout, stderr := runCLI(t, "", "fmt", unformatted)
+	assert.Equal(t, code, exitOK, stderr)
+	assert.Equal(t, stdout, formattedEnvFile)
+
+	code, stdout, stderr = runCLI(t, "", "fmt", "-l", unformatted, formatted)
+	assert.Equal(t, code, exitOK, stderr)
+	assert.Equal(t, stdout, unformatted+"\n")
+
+	code, stdout, stderr = runCLI(t, "", "fmt", "-w", unformatted, formatted)
+	assert.Equal(t, code, exitOK, stderr)
+	assert.Equal(t, stdout, "")
+	data, err := ioutil.ReadFile(unformatted)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), formattedEnvFile)
+	fi, err := os.Stat(unformatted)
+	assert.NilError(t, err)
+	assert.Equal(t, fi.Mode().Perm(), os.FileMode(0640))
+
+	code, stdout, stderr = runCLI(t, "", "fmt", "-l", unformatted)
+	assert.Equal(t, code, exitOK, stderr)
+	assert.Equal(t, stdout, "")
+}
+
+func TestFmtDiff(t *testing.T) {
+	env := writeFile(t, t.TempDir(), ".env", "# db\nA=1\nB = 2\nC=3\nD=4\nE=5\nF=6\nG=7\nH=8\nI=9\nJ = 10", 0600)
+
+	code, stdout, stderr := runCLI(t, "", "fmt", "-d", env)
+	assert.Equal(t, code, exitOK, stderr)
+	assert.Equal(t, stdout, strings.ReplaceAll(`--- ENV
++++ ENV
+@@ -1,6 +1,6 @@
+ # db
+ A=1
+-B = 2
++B=2
+ C=3
+ D=4
+ E=5
+@@ -8,4 +8,4 @@
+ G=7
+ H=8
+ I=9
+-J = 10
+\ No newline at end of file
++J=10
+`, "ENV", env))
+}
+
+func TestFmtError(t *testing.T) {
+	dir := t.TempDir()
+	invalid := writeFile(t, dir, "invalid.env", "BAD_VALUE\n", 0600)
+	formatted := writeFile(t, dir, "formatted.env", formattedEnvFile, 0600)
+
+	code, stdout, stderr := runCLI(t, "", "fmt", "-l", invalid, filepath.Join(dir, "missing.env"), formatted)
+	assert.Equal(t, code, exitError)
+	assert.Equal(t, stdout, "")
+	assert.Assert(t, strings.Contains(stderr, "serum: fmt: "+invalid+": envfile: syntax error at line 1"), stderr)
+	assert.Assert(t, strings.Contains(stderr, "missing.env"), stderr)
+}
@@ -0,0 +1,178 @@
+// Command serum injects environment variables and secrets loaded from .env files
+// into other processes, and provides tooling to work with .env files.
+//
+// Usage:
+//
+//	serum <command> [flags] [arguments]
+//
+// Run serum help <command> for the flags of a command.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command is a serum subcommand.
+type command struct {
+	usage string
+	short string
+	run   func(c *cli, args []string) int
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"check": {
+			usage: "check [flags] [file...]",
+			short: "lint .env files without decrypting them",
+			run:   (*cli).check,
+		},
+		"diff": {
+			usage: "diff [flags] <left.env> <right.env>",
+			short: "compare the env vars of two .env files without printing secrets",
+			run:   (*cli).diff,
+		},
+		"export": {
+			usage: "export [flags]",
+			short: "write the env vars of .env files in the format of another tool",
+			run:   (*cli).export,
+		},
+		"fmt": {
+			usage: "fmt [flags] [file...]",
+			short: "format .env files",
+			run:   (*cli).fmtCmd,
+		},
+		"get": {
+			usage: "get [flags] <key>",
+			short: "print the value of a key of a .env file without decrypting it",
+			run:   (*cli).get,
+		},
+		"run": {
+			usage: "run [flags] -- <command> [arguments]",
+			short: "run a command with the env vars and secrets of .env files",
+			run:   (*cli).run,
+		},
+		"secrets": {
+			usage: "secrets create [flags] <key> <secret>",
+			short: "create a secret in Secret Manager and reference it in a .env file",
+			run:   (*cli).secrets,
+		},
+		"set": {
+			usage: "set [flags] <key> [value]",
+			short: "add, update or delete a key of a .env file, keeping its formatting",
+			run:   (*cli).set,
+		},
+	}
+}
+
+// cli contains the streams serum reads from and writes to.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	os.Exit(c.main(os.Args[1:]))
+}
+
+// main runs the subcommand in args and returns the exit code.
+func (c *cli) main(args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return exitUsage
+	}
+
+	name, args := args[0], args[1:]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		if len(args) == 0 {
+			c.usage()
+			return exitOK
+		}
+		cmd, ok := commands[args[0]]
+		if !ok {
+			c.errorf("unknown command %q", args[0])
+			return exitUsage
+		}
+		return cmd.run(c, []string{"-h"})
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		c.errorf("unknown command %q", name)
+		c.usage()
+		return exitUsage
+	}
+
+	return cmd.run(c, args)
+}
+
+func (c *cli) usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Usage: serum <command> [flags] [arguments]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-10s %s\n", name, commands[name].short)
+	}
+	b.WriteString("\nRun serum help <command> for the flags of a command.\n")
+	fmt.Fprint(c.stderr, b.String())
+}
+
+// flagSet returns a flag set for the command name that writes its usage to stderr.
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: serum %s\n\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// parseFlags parses args into fs and returns the exit code to return when parsing fails.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+
+	return exitOK, true
+}
+
+func (c *cli) errorf(format string, args ...interface{}) {
+	fmt.Fprintf(c.stderr, "serum: "+format+"\n", args...)
+}
+
+// stringsFlag is a flag that can be set more than once.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCLIMain(t *testing.T) {
+	tt := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedStderr string
+	}{
+		{
+			name:           "no command",
+			expectedCode:   exitUsage,
+			expectedStderr: "Usage: serum <command>",
+		},
+		{
+			name:           "help",
+			args:           []string{"help"},
+			expectedCode:   exitOK,
+			expectedStderr: "run        run a command",
+		},
+		{
+			name:           "command help",
+			args:           []string{"help", "run"},
+			expectedCode:   exitOK,
+			expectedStderr: "Usage: serum run [flags] -- <command> [arguments]",
+		},
+		{
+			name:           "unknown command",
+			args:           []string{"launch"},
+			expectedCode:   exitUsage,
+			expectedStderr: `serum: unknown command "launch"`,
+		},
+		{
+			name:           "unknown command help",
+			args:           []string{"help", "launch"},
+			expectedCode:   exitUsage,
+			expectedStderr: `serum: unknown command "launch"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, "", tc.args...)
+			assert.Equal(t, code, tc.expectedCode)
+			assert.Equal(t, stdout, "")
+			assert.Assert(t, strings.Contains(stderr, tc.expectedStderr), stderr)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wingocard/serum"
+	"github.com/wingocard/serum/secretprovider"
+	"github.com/wingocard/serum/secretprovider/agefile"
+	"github.com/wingocard/serum/secretprovider/azkeyvault"
+	"github.com/wingocard/serum/secretprovider/exec"
+	"github.com/wingocard/serum/secretprovider/gkms"
+	"github.com/wingocard/serum/secretprovider/gsmanager"
+	"github.com/wingocard/serum/secretprovider/k8s"
+	"github.com/wingocard/serum/secretprovider/vault"
+)
+
+const providerEnv = "SERUM_PROVIDER"
+
+// providerFlags configure the SecretProvider used to decrypt secrets. Flags default to the
+// env variables the providers' SDKs use, so serum works unchanged in configured environments.
+type providerFlags struct {
+	provider string
+
+	gcpProject string
+	gcpRegion  string
+
+	vaultAddr      string
+	vaultAuth      string
+	vaultRole      string
+	vaultNamespace string
+
+	ageIdentity string
+
+	execCommand string
+	execMode    string
+	execTimeout time.Duration
+}
+
+func (p *providerFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&p.provider, "provider", os.Getenv(providerEnv),
+		"secret provider: gsmanager, vault, azkeyvault, gkms, age, k8s or exec (env "+providerEnv+")")
+
+	fs.StringVar(&p.gcpProject, "gcp-project", "", "gsmanager: default project of short secret references")
+	fs.StringVar(&p.gcpRegion, "gcp-region", "", "gsmanager: regional endpoint to use")
+
+	fs.StringVar(&p.vaultAddr, "vault-addr", "", "vault: server address (env VAULT_ADDR)")
+	fs.StringVar(&p.vaultAuth, "vault-auth", "token",
+		"vault: auth method: token (env VAULT_TOKEN), approle (env VAULT_ROLE_ID and VAULT_SECRET_ID) or kubernetes")
+	fs.StringVar(&p.vaultRole, "vault-role", "", "vault: role used by kubernetes auth")
+	fs.StringVar(&p.vaultNamespace, "vault-namespace", os.Getenv("VAULT_NAMESPACE"),
+		"vault: namespace (env VAULT_NAMESPACE)")
+
+	fs.StringVar(&p.ageIdentity, "age-identity", "", "age: identity file (default env "+agefile.DefaultIdentityEnv+")")
+
+	fs.StringVar(&p.execCommand, "exec-command", "", "exec: plugin command and arguments, quoted like in a shell")
+	fs.StringVar(&p.execMode, "exec-mode", "argument",
+		"exec: how secrets are passed to the plugin: argument, stdin or batch")
+	fs.DurationVar(&p.execTimeout, "exec-timeout", exec.DefaultTimeout, "exec: plugin timeout")
+}
+
+// newInjector returns an Injector that loads the layered .env files and decrypts their
+// secrets using the configured SecretProvider.
+func (p *providerFlags) newInjector(ctx context.Context, envFiles []string) (*serum.Injector, error) {
+	return serum.NewInjector(serum.FromFiles(envFiles...), serum.WithSecretProviderFunc(
+		func() (secretprovider.SecretProvider, error) {
+			return p.newSecretProvider(ctx)
+		},
+	))
+}
+
+// newSecretProvider returns the configured SecretProvider, or nil if no provider is configured.
+func (p *providerFlags) newSecretProvider(ctx context.Context) (secretprovider.SecretProvider, error) {
+	switch p.provider {
+	case "":
+		return nil, nil
+	case "gsmanager":
+		var options []gsmanager.Option
+		if p.gcpProject != "" {
+			options = append(options, gsmanager.WithProject(p.gcpProject))
+		}
+		if p.gcpRegion != "" {
+			options = append(options, gsmanager.WithRegion(p.gcpRegion))
+		}
+		return gsmanager.New(ctx, options...)
+	case "vault":
+		auth, err := p.vaultAuthMethod()
+		if err != nil {
+			return nil, err
+		}
+		var options []vault.Option
+		if p.vaultNamespace != "" {
+			options = append(options, vault.WithNamespace(p.vaultNamespace))
+		}
+		return vault.New(ctx, p.vaultAddr, auth, options...)
+	case "azkeyvault":
+		return azkeyvault.New(azureCredential())
+	case "gkms":
+		return gkms.New(ctx)
+	case "age":
+		var options []agefile.Option
+		if p.ageIdentity != "" {
+			options = append(options, agefile.WithIdentityFile(p.ageIdentity))
+		}
+		return agefile.New(options...)
+	case "k8s":
+		return k8s.New()
+	case "exec":
+		return p.newExec()
+	default:
+		return nil, fmt.Errorf("unknown secret provider %q", p.provider)
+	}
+}
+
+func (p *providerFlags) vaultAuthMethod() (vault.AuthMethod, error) {
+	switch p.vaultAuth {
+	case "token":
+		return vault.TokenAuth(os.Getenv("VAULT_TOKEN")), nil
+	case "approle":
+		return vault.AppRoleAuth(os.Getenv("VAULT_ROLE_ID"), os.Getenv("VAULT_SECRET_ID")), nil
+	case "kubernetes":
+		return vault.KubernetesAuth(p.vaultRole, ""), nil
+	default:
+		return nil, fmt.Errorf("unknown vault auth method %q", p.vaultAuth)
+	}
+}
+
+// azureCredential returns a client secret credential when the AZURE_TENANT_ID, AZURE_CLIENT_ID
+// and AZURE_CLIENT_SECRET env variables are set, and a managed identity credential otherwise.
+func azureCredential() azkeyvault.Credential {
+	tenantID, clientID := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID")
+	secret := os.Getenv("AZURE_CLIENT_SECRET")
+	if tenantID != "" && clientID != "" && secret != "" {
+		return azkeyvault.ClientSecretCredential(tenantID, clientID, secret)
+	}
+
+	return azkeyvault.ManagedIdentityCredential(clientID)
+}
+
+func (p *providerFlags) newExec() (*exec.Exec, error) {
+	args, err := splitCommand(p.execCommand)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -exec-command: %w", err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("exec provider requires -exec-command")
+	}
+
+	var mode exec.Mode
+	switch p.execMode {
+	case "argument":
+		mode = exec.ModeArgument
+	case "stdin":
+		mode = exec.ModeStdin
+	case "batch":
+		mode = exec.ModeBatch
+	default:
+		return nil, fmt.Errorf("unknown exec mode %q", p.execMode)
+	}
+
+	return exec.New(args[0], args[1:], exec.WithMode(mode), exec.WithTimeout(p.execTimeout))
+}
+
+// splitCommand splits s into words the way a POSIX shell does, without expansions. Single quotes
+// preserve everything they contain, double quotes preserve everything but backslash escapes of
+// ", \, $ and ` and a backslash outside of quotes escapes the next character.
+func splitCommand(s string) ([]string, error) {
+	var (
+		words []string
+		word  strings.Builder
+		// inWord is set once a word is started, so "" is kept as an empty argument
+		inWord bool
+		quote  rune
+		escape bool
+	)
+	for _, r := range s {
+		switch {
+		case escape:
+			if quote == '"' && !strings.ContainsRune("\"$`\\", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escape = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+				continue
+			}
+			word.WriteRune(r)
+		case r == '\\':
+			escape, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+				continue
+			}
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if escape || quote != 0 {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tt := []struct {
+		name        string
+		command     string
+		expected    []string
+		expectedErr string
+	}{
+		{
+			name:     "words",
+			command:  "  plugin  --mode\tbatch ",
+			expected: []string{"plugin", "--mode", "batch"},
+		},
+		{
+			name:     "single quotes",
+			command:  `'/opt/my plugins/plugin' 'it''s' '\n'`,
+			expected: []string{"/opt/my plugins/plugin", "its", `\n`},
+		},
+		{
+			name:     "double quotes",
+			command:  `"/opt/my plugins/plugin" "say \"hi\"" "\n" ""`,
+			expected: []string{"/opt/my plugins/plugin", `say "hi"`, `\n`, ""},
+		},
+		{
+			name:     "escapes",
+			command:  `/opt/my\ plugins/plugin \'`,
+			expected: []string{"/opt/my plugins/plugin", "'"},
+		},
+		{
+			name:     "empty",
+			command:  " ",
+			expected: nil,
+		},
+		{
+			name:        "unterminated quote",
+			command:     `plugin "arg`,
+			expectedErr: "unterminated quote or escape",
+		},
+		{
+			name:        "unterminated escape",
+			command:     `plugin \`,
+			expectedErr: "unterminated quote or escape",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			words, err := splitCommand(tc.command)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.DeepEqual(t, words, tc.expected)
+		})
+	}
+}
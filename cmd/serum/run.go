@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	osexec "os/exec"
+	"os/signal"
+)
+
+const (
+	defaultEnvFile = ".env"
+	// exitNotExecutable and exitNotFound are returned when the command can not be started,
+	// like shells do.
+	exitNotExecutable = 126
+	exitNotFound      = 127
+)
+
+// run loads and decrypts the .env files into serum's environment and runs the command with it.
+// Signals received by serum are forwarded to the command, unless the terminal sent them to both, and
+// serum exits with the command's exit code.
+// serum waits for the command instead of replacing itself with it, so secret files can be removed
+// when the command exits.
+func (c *cli) run(args []string) int {
+	var (
+		envFiles stringsFlag
+		pf       providerFlags
+	)
+	fs := c.flagSet("run")
+	fs.Var(&envFiles, "env-file", "`path` of a .env file, can be repeated to layer files (default .env)")
+	pf.register(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if fs.NArg() == 0 {
+		c.errorf("run: no command provided")
+		fs.Usage()
+		return exitUsage
+	}
+	if len(envFiles) == 0 {
+		envFiles = stringsFlag{defaultEnvFile}
+	}
+
+	ctx := context.Background()
+	ij, err := pf.newInjector(ctx, envFiles)
+	if err != nil {
+		c.errorf("run: %s", err)
+		return exitError
+	}
+	defer func() {
+		if err := ij.Close(); err != nil {
+			c.errorf("run: %s", err)
+		}
+	}()
+
+	if err := ij.Inject(ctx); err != nil {
+		c.errorf("run: %s", err)
+		return exitError
+	}
+
+	return c.exec(fs.Args())
+}
+
+// exec runs the command in args with serum's environment, forwarding signals to it,
+// and returns its exit code.
+func (c *cli) exec(args []string) int {
+	cmd := osexec.Command(args[0], args[1:]...) //nolint:gosec
+	cmd.Env = os.Environ()
+	cmd.Stdin = c.stdin
+	cmd.Stdout = c.stdout
+	cmd.Stderr = c.stderr
+
+	// start listening before the command starts so no signal is missed
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+	defer signal.Stop(sigs)
+
+	if err := cmd.Start(); err != nil {
+		c.errorf("run: %s", err)
+		if errors.Is(err, os.ErrPermission) {
+			return exitNotExecutable
+		}
+		return exitNotFound
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				// the command is in serum's process group and already received the signals
+				// sent by the terminal
+				if !fromTerminal(sig) {
+					_ = cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	var exitErr *osexec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		c.errorf("run: %s", err)
+		return exitError
+	}
+
+	return exitCode(cmd.ProcessState)
+}
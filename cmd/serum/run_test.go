@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// runCLI runs serum with args and returns its exit code, stdout and stderr.
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}
+	code := c.main(args)
+
+	return code, stdout.String(), stderr.String()
+}
+
+// writeFile writes content to name in dir and returns its path.
+func writeFile(t *testing.T, dir, name, content string, perm os.FileMode) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	assert.NilError(t, ioutil.WriteFile(path, []byte(content), perm))
+	return path
+}
+
+// unsetEnv removes the env vars injected by serum into the test process.
+func unsetEnv(t *testing.T, keys ...string) {
+	t.Cleanup(func() {
+		for _, k := range keys {
+			os.Unsetenv(k)
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	base := writeFile(t, dir, ".env", "RUN_HOST=localhost\nRUN_PORT=5432\n", 0600)
+	local := writeFile(t, dir, ".env.local", "RUN_PORT=5433\n", 0600)
+	secrets := writeFile(t, dir, "secrets.env", "RUN_PASSWORD=!{db-password}\nRUN_TLS_KEY=!file{tls-key}\n", 0600)
+	plugin := writeFile(t, dir, "plugin.sh", "#!/bin/sh\nprintf 'decrypted-%s' \"$1\"\n", 0700)
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, "plugin dir"), 0700))
+	spacedPlugin := writeFile(t, dir, "plugin dir/plugin.sh", "#!/bin/sh\nprintf '%s-%s' \"$1\" \"$2\"\n", 0700)
+	notExecutable := writeFile(t, dir, "script.sh", "#!/bin/sh\n", 0600)
+
+	tt := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			name:           "plain",
+			args:           []string{"run", "-env-file", base, "--", "sh", "-c", `echo "$RUN_HOST:$RUN_PORT"`},
+			expectedStdout: "localhost:5432\n",
+		},
+		{
+			name: "layered files",
+			args: []string{"run", "-env-file", base, "-env-file", local, "--",
+				"sh", "-c", `echo "$RUN_HOST:$RUN_PORT"`},
+			expectedStdout: "localhost:5433\n",
+		},
+		{
+			name: "secrets",
+			args: []string{"run", "-env-file", secrets, "-provider", "exec", "-exec-command", plugin, "--",
+				"sh", "-c", `echo "$RUN_PASSWORD"; cat "$RUN_TLS_KEY"`},
+			expectedStdout: "decrypted-db-password\ndecrypted-tls-key",
+		},
+		{
+			name: "quoted exec command",
+			args: []string{"run", "-env-file", secrets, "-provider", "exec",
+				"-exec-command", `"` + spacedPlugin + `" 'my prefix'`, "--", "sh", "-c", `echo "$RUN_PASSWORD"`},
+			expectedStdout: "my prefix-db-password\n",
+		},
+		{
+			name:           "stdin",
+			args:           []string{"run", "-env-file", base, "cat"},
+			expectedStdout: "input",
+		},
+		{
+			name:         "exit code",
+			args:         []string{"run", "-env-file", base, "--", "sh", "-c", "exit 3"},
+			expectedCode: 3,
+		},
+		{
+			name:           "command not found",
+			args:           []string{"run", "-env-file", base, "--", filepath.Join(dir, "missing")},
+			expectedCode:   exitNotFound,
+			expectedStderr: "serum: run: fork/exec",
+		},
+		{
+			name:           "command not executable",
+			args:           []string{"run", "-env-file", base, "--", notExecutable},
+			expectedCode:   exitNotExecutable,
+			expectedStderr: "permission denied",
+		},
+		{
+			name:           "no command",
+			args:           []string{"run", "-env-file", base},
+			expectedCode:   exitUsage,
+			expectedStderr: "serum: run: no command provided",
+		},
+		{
+			name:           "missing env file",
+			args:           []string{"run", "-env-file", filepath.Join(dir, "missing.env"), "--", "true"},
+			expectedCode:   exitError,
+			expectedStderr: "error loading env vars from file",
+		},
+		{
+			name:           "secrets without provider",
+			args:           []string{"run", "-env-file", secrets, "--", "true"},
+			expectedCode:   exitError,
+			expectedStderr: "secrets were loaded but the SecretProvider is nil",
+		},
+		{
+			name:           "unknown provider",
+			args:           []string{"run", "-env-file", base, "-provider", "keepass", "--", "true"},
+			expectedCode:   exitError,
+			expectedStderr: `unknown secret provider "keepass"`,
+		},
+		{
+			name:           "exec provider without command",
+			args:           []string{"run", "-env-file", base, "-provider", "exec", "--", "true"},
+			expectedCode:   exitError,
+			expectedStderr: "exec provider requires -exec-command",
+		},
+		{
+			name:           "invalid flag",
+			args:           []string{"run", "-bad-flag"},
+			expectedCode:   exitUsage,
+			expectedStderr: "flag provided but not defined: -bad-flag",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			unsetEnv(t, "RUN_HOST", "RUN_PORT", "RUN_PASSWORD", "RUN_TLS_KEY")
+
+			code, stdout, stderr := runCLI(t, "input", tc.args...)
+			assert.Equal(t, code, tc.expectedCode, stderr)
+			assert.Equal(t, stdout, tc.expectedStdout)
+			if tc.expectedStderr == "" {
+				assert.Equal(t, stderr, "")
+				return
+			}
+			assert.Assert(t, strings.Contains(stderr, tc.expectedStderr), stderr)
+		})
+	}
+}
+
+func TestRunRemovesSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	secrets := writeFile(t, dir, "secrets.env", "RUN_TLS_KEY=!file{tls-key}\n", 0600)
+	plugin := writeFile(t, dir, "plugin.sh", "#!/bin/sh\nprintf 'decrypted-%s' \"$1\"\n", 0700)
+	unsetEnv(t, "RUN_TLS_KEY")
+
+	code, stdout, stderr := runCLI(t, "", "run", "-env-file", secrets, "-provider", "exec", "-exec-command", plugin,
+		"--", "sh", "-c", `echo "$RUN_TLS_KEY"`)
+	assert.Equal(t, code, exitOK, stderr)
+
+	_, err := os.Stat(strings.TrimSpace(stdout))
+	assert.Assert(t, os.IsNotExist(err))
+}
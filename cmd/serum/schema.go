@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+
+	"github.com/wingocard/serum/internal/envparser"
+)
+
+// Schema rules reported by serum check.
+const (
+	ruleNamingConvention = "naming-convention"
+	ruleMissingKey       = "missing-key"
+	ruleUnknownKey       = "unknown-key"
+	ruleExpectedSecret   = "expected-secret"
+	ruleExpectedPlain    = "expected-plain"
+	rulePatternMismatch  = "pattern-mismatch"
+)
+
+// schema describes the keys expected in a .env file.
+//
+//	{
+//	  "additionalKeys": false,
+//	  "keys": {
+//	    "DB_PASSWORD": {"required": true, "secret": true},
+//	    "PORT": {"pattern": "^[0-9]+$"}
+//	  }
+//	}
+type schema struct {
+	// AdditionalKeys allows keys that are not in Keys. It defaults to true.
+	AdditionalKeys *bool                `json:"additionalKeys"`
+	Keys           map[string]schemaKey `json:"keys"`
+}
+
+type schemaKey struct {
+	Required bool `json:"required"`
+	// Secret requires the value to be a secret when true, or plain text when false.
+	Secret *bool `json:"secret"`
+	// Pattern is a regular expression plain text values must match.
+	Pattern string `json:"pattern"`
+
+	patternRe *regexp.Regexp
+}
+
+func loadSchema(path string) (*schema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema: %w", err)
+	}
+
+	var s schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("error parsing schema %s: %w", path, err)
+	}
+
+	for k, sk := range s.Keys {
+		if sk.Pattern == "" {
+			continue
+		}
+		if sk.patternRe, err = regexp.Compile(sk.Pattern); err != nil {
+			return nil, fmt.Errorf("error parsing schema %s: invalid pattern of %s: %w", path, k, err)
+		}
+		s.Keys[k] = sk
+	}
+
+	return &s, nil
+}
+
+// check returns the issues found validating the entries of a .env file against the schema.
+// Values are never included in the issues.
+func (s *schema) check(entries []envparser.Entry) []envparser.Issue {
+	var issues []envparser.Issue
+	defined := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		defined[e.Key] = true
+
+		sk, ok := s.Keys[e.Key]
+		if !ok {
+			if s.AdditionalKeys != nil && !*s.AdditionalKeys {
+				issues = append(issues, envparser.Issue{
+					Line: e.Line, Key: e.Key, Rule: ruleUnknownKey,
+					Message: fmt.Sprintf("key %s is not defined in the schema", e.Key),
+				})
+			}
+			continue
+		}
+
+		switch {
+		case sk.Secret != nil && *sk.Secret && !e.Secret:
+			issues = append(issues, envparser.Issue{
+				Line: e.Line, Key: e.Key, Rule: ruleExpectedSecret,
+				Message: fmt.Sprintf("%s must be a secret", e.Key),
+			})
+		case sk.Secret != nil && !*sk.Secret && e.Secret:
+			issues = append(issues, envparser.Issue{
+				Line: e.Line, Key: e.Key, Rule: ruleExpectedPlain,
+				Message: fmt.Sprintf("%s must be a plain text value", e.Key),
+			})
+		case sk.patternRe != nil && !e.Secret && !sk.patternRe.MatchString(e.Value):
+			issues = append(issues, envparser.Issue{
+				Line: e.Line, Key: e.Key, Rule: rulePatternMismatch,
+				Message: fmt.Sprintf("value of %s does not match %s", e.Key, sk.Pattern),
+			})
+		}
+	}
+
+	var missing []string
+	for k, sk := range s.Keys {
+		if sk.Required && !defined[k] {
+			missing = append(missing, k)
+		}
+	}
+	sort.Strings(missing)
+	for _, k := range missing {
+		issues = append(issues, envparser.Issue{
+			Key: k, Rule: ruleMissingKey, Message: fmt.Sprintf("required key %s is missing", k),
+		})
+	}
+
+	return issues
+}
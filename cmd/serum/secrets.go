@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/wingocard/serum/secretprovider/gsmanager"
+	"golang.org/x/term"
+)
+
+// secretStore adds secret versions to a secret manager.
+type secretStore interface {
+	AddVersion(ctx context.Context, secret string, value []byte) (string, error)
+	Close() error
+}
+
+// newSecretStore returns the secret store used by serum secrets, it is replaced by tests.
+var newSecretStore = func(ctx context.Context, project, region string) (secretStore, error) {
+	var options []gsmanager.Option
+	if project != "" {
+		options = append(options, gsmanager.WithProject(project))
+	}
+	if region != "" {
+		options = append(options, gsmanager.WithRegion(region))
+	}
+
+	return gsmanager.New(ctx, options...)
+}
+
+// secrets runs the serum secrets subcommands.
+func (c *cli) secrets(args []string) int {
+	if len(args) == 0 {
+		c.errorf("secrets: expected a subcommand")
+		fmt.Fprintf(c.stderr, "Usage: serum %s\n", commands["secrets"].usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "create":
+		return c.secretsCreate(args[1:])
+	case "-h", "-help", "--help":
+		return c.secretsCreate(args)
+	default:
+		c.errorf("secrets: unknown subcommand %q", args[0])
+		return exitUsage
+	}
+}
+
+// secretsCreate adds the value read from stdin, or a prompt, as a new version of a Secret Manager
+// secret, creating the secret if needed, and sets a key of a .env file to reference it.
+func (c *cli) secretsCreate(args []string) int {
+	var (
+		envFile    string
+		project    string
+		region     string
+		fileSecret bool
+		latest     bool
+	)
+	fs := c.flagSet("secrets")
+	fs.StringVar(&envFile, "env-file", defaultEnvFile, "`path` of the .env file to update")
+	fs.StringVar(&project, "gcp-project", "", "project of short secret names")
+	fs.StringVar(&region, "gcp-region", "", "create regional secrets in region")
+	fs.BoolVar(&fileSecret, "file-secret", false, "reference the secret as a secret file, !file{...}")
+	fs.BoolVar(&latest, "latest", false, "reference the secret's latest version instead of the created version")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if fs.NArg() != 2 {
+		c.errorf("secrets create: expected a key and a secret name")
+		fs.Usage()
+		return exitUsage
+	}
+	key, secret := fs.Arg(0), fs.Arg(1)
+
+	// read the .env file first so a file that can't be updated doesn't leave an unused version behind
+	doc, err := readDocument(envFile, true)
+	if err != nil {
+		c.errorf("secrets create: %s", err)
+		return exitError
+	}
+
+	value, err := c.secretValue(key)
+	if err != nil {
+		c.errorf("secrets create: %s", err)
+		return exitError
+	}
+
+	ctx := context.Background()
+	store, err := newSecretStore(ctx, project, region)
+	if err != nil {
+		c.errorf("secrets create: %s", err)
+		return exitError
+	}
+	defer store.Close()
+
+	version, err := store.AddVersion(ctx, secret, value)
+	if err != nil {
+		c.errorf("secrets create: %s", err)
+		return exitError
+	}
+
+	ref := version
+	if i := strings.LastIndex(version, "/versions/"); latest && i >= 0 {
+		ref = version[:i]
+	}
+	ref = "{" + ref + "}"
+	if fileSecret {
+		ref = "!file" + ref
+	} else {
+		ref = "!" + ref
+	}
+
+	if err := doc.Set(key, ref); err != nil {
+		c.errorf("secrets create: created %s but failed to update %s: %s", version, envFile, err)
+		return exitError
+	}
+	if err := writeFileAtomic(envFile, doc.Bytes()); err != nil {
+		c.errorf("secrets create: created %s but failed to update %s: %s", version, envFile, err)
+		return exitError
+	}
+
+	fmt.Fprintln(c.stdout, version)
+	return exitOK
+}
+
+// secretValue prompts for the value of key when stdin is a terminal, without echoing it, and reads
+// stdin otherwise. A single trailing newline is removed.
+func (c *cli) secretValue(key string) ([]byte, error) {
+	var (
+		value []byte
+		err   error
+	)
+	if f, ok := c.stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fmt.Fprintf(c.stderr, "Value of %s: ", key)
+		value, err = term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(c.stderr)
+	} else {
+		value, err = ioutil.ReadAll(c.stdin)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading value: %w", err)
+	}
+
+	v := strings.TrimSuffix(string(value), "\n")
+	v = strings.TrimSuffix(v, "\r")
+	if v == "" {
+		return nil, fmt.Errorf("value of %s is empty", key)
+	}
+
+	return []byte(v), nil
+}
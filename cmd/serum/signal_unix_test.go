@@ -0,0 +1,67 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRunForwardsSignals(t *testing.T) {
+	dir := t.TempDir()
+	env := writeFile(t, dir, ".env", "RUN_SIGNAL=TERM\n", 0600)
+	ready := filepath.Join(dir, "ready")
+	unsetEnv(t, "RUN_SIGNAL")
+
+	script := `trap 'echo "got $RUN_SIGNAL"; exit 7' TERM; touch "$0"; while :; do sleep 0.05; done`
+	done := make(chan int)
+	var stdout, stderr bytes.Buffer
+	go func() {
+		c := &cli{stdin: &bytes.Buffer{}, stdout: &stdout, stderr: &stderr}
+		done <- c.main([]string{"run", "-env-file", env, "--", "sh", "-c", script, ready})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("command did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// serum is listening for SIGTERM, so the test process is not terminated
+	assert.NilError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	select {
+	case code := <-done:
+		assert.Equal(t, code, 7, stderr.String())
+		assert.Equal(t, stdout.String(), "got TERM\n")
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal was not forwarded")
+	}
+}
+
+func TestFromTerminal(t *testing.T) {
+	// only signals sent by the keyboard reach the whole process group
+	assert.Equal(t, fromTerminal(syscall.SIGTERM), false)
+	assert.Equal(t, fromTerminal(syscall.SIGUSR1), false)
+}
+
+func TestRunSignaledExitCode(t *testing.T) {
+	dir := t.TempDir()
+	env := writeFile(t, dir, ".env", "RUN_SIGNAL=KILL\n", 0600)
+	unsetEnv(t, "RUN_SIGNAL")
+
+	code, _, stderr := runCLI(t, "", "run", "-env-file", env, "--", "sh", "-c", `kill -s "$RUN_SIGNAL" $$`)
+	assert.Equal(t, code, 128+int(syscall.SIGKILL), stderr)
+}
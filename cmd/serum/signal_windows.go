@@ -0,0 +1,17 @@
+package main
+
+import "os"
+
+// forwardedSignals are the signals forwarded to the command started by serum run.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// fromTerminal reports whether sig was generated by the console, which sends Ctrl+C to every
+// process attached to it. It is the only signal received on Windows.
+func fromTerminal(sig os.Signal) bool {
+	return true
+}
+
+// exitCode returns the exit code of a process.
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
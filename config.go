@@ -0,0 +1,173 @@
+package serum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrMissingKey is returned, wrapped in a ConfigError, by the accessors of Config when a key
+// is not set and no default is given.
+var ErrMissingKey = errors.New("key is not set")
+
+// ConfigError is returned by the accessors of Config when a key is not set or its value can not
+// be parsed as the requested type. The value is never included, it may be a secret.
+type ConfigError struct {
+	Key string
+	// Type is the requested type, e.g. int or duration
+	Type string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	if errors.Is(e.Err, ErrMissingKey) {
+		return fmt.Sprintf("serum: config key %s: %s", e.Key, e.Err)
+	}
+	return fmt.Sprintf("serum: config key %s is not a valid %s: %s", e.Key, e.Type, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Config gives typed access to the resolved env vars of an Injector. The values are kept up to date
+// by Injector.Watch and Injector.WatchFiles, and reads are safe while they are updated.
+type Config struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// Config resolves the loaded env vars, decrypting their secrets, and returns a Config to read them.
+// The Config is updated when Watch detects rotated secrets and when WatchFiles reloads changed .env
+// files. Calling Config again resolves the env vars again and returns the same Config.
+func (ij *Injector) Config(ctx context.Context) (*Config, error) {
+	for {
+		env := ij.loaded()
+		resolved, err := ij.resolve(ctx, env)
+		if err != nil {
+			return nil, err
+		}
+
+		ij.mu.Lock()
+		// env vars reloaded while they were resolved are resolved again, so stale keys are not kept
+		if ij.envVars == env {
+			if ij.config == nil {
+				ij.config = &Config{}
+			}
+			ij.config.replace(resolved)
+			config := ij.config
+			ij.mu.Unlock()
+			return config, nil
+		}
+		ij.mu.Unlock()
+	}
+}
+
+func (c *Config) replace(values map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values = values
+}
+
+func (c *Config) lookup(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v, ok := c.values[key]
+	return v, ok
+}
+
+// String returns the value of key. If key is not set, the default is returned when one is
+// given, otherwise a ConfigError wrapping ErrMissingKey is returned.
+func (c *Config) String(key string, def ...string) (string, error) {
+	v, ok := c.lookup(key)
+	if !ok {
+		if len(def) > 0 {
+			return def[0], nil
+		}
+		return "", &ConfigError{Key: key, Type: "string", Err: ErrMissingKey}
+	}
+
+	return v, nil
+}
+
+// Int returns the value of key parsed as a base 10 int. If key is not set, the default is returned
+// when one is given, otherwise a ConfigError wrapping ErrMissingKey is returned.
+func (c *Config) Int(key string, def ...int) (int, error) {
+	v, ok := c.lookup(key)
+	if !ok {
+		if len(def) > 0 {
+			return def[0], nil
+		}
+		return 0, &ConfigError{Key: key, Type: "int", Err: ErrMissingKey}
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, &ConfigError{Key: key, Type: "int", Err: numError(err)}
+	}
+	return i, nil
+}
+
+// Duration returns the value of key parsed using time.ParseDuration, e.g. 1m30s. If key is not set,
+// the default is returned when one is given, otherwise a ConfigError wrapping ErrMissingKey is returned.
+func (c *Config) Duration(key string, def ...time.Duration) (time.Duration, error) {
+	v, ok := c.lookup(key)
+	if !ok {
+		if len(def) > 0 {
+			return def[0], nil
+		}
+		return 0, &ConfigError{Key: key, Type: "duration", Err: ErrMissingKey}
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		// the error of ParseDuration includes the value
+		return 0, &ConfigError{Key: key, Type: "duration", Err: errors.New("invalid duration")}
+	}
+	return d, nil
+}
+
+// Bool returns the value of key parsed using strconv.ParseBool, e.g. true, false, 1 or 0. If key is
+// not set, the default is returned when one is given, otherwise a ConfigError wrapping ErrMissingKey
+// is returned.
+func (c *Config) Bool(key string, def ...bool) (bool, error) {
+	v, ok := c.lookup(key)
+	if !ok {
+		if len(def) > 0 {
+			return def[0], nil
+		}
+		return false, &ConfigError{Key: key, Type: "bool", Err: ErrMissingKey}
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &ConfigError{Key: key, Type: "bool", Err: numError(err)}
+	}
+	return b, nil
+}
+
+// Secret returns the value of key as a Secret, which is redacted when it is printed or marshalled.
+// If key is not set, a ConfigError wrapping ErrMissingKey is returned.
+func (c *Config) Secret(key string) (Secret, error) {
+	v, ok := c.lookup(key)
+	if !ok {
+		return Secret{}, &ConfigError{Key: key, Type: "secret", Err: ErrMissingKey}
+	}
+
+	return NewSecret(v), nil
+}
+
+// numError returns the cause of a strconv error, without the value it includes.
+func numError(err error) error {
+	var ne *strconv.NumError
+	if errors.As(err, &ne) {
+		return ne.Err
+	}
+	return err
+}
@@ -0,0 +1,284 @@
+package serum
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wingocard/serum/internal/envparser"
+	"github.com/wingocard/serum/secretprovider"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+)
+
+func newTestConfig(t *testing.T) *Config {
+	t.Helper()
+
+	ij := &Injector{
+		envVars: &envparser.EnvVars{
+			Plain: map[string]string{
+				"HOST":    "localhost",
+				"PORT":    "8080",
+				"TIMEOUT": "1m30s",
+				"DEBUG":   "true",
+				"INVALID": "abc",
+			},
+			Secrets: map[string]string{"DB_PASSWORD": "db-password"},
+		},
+		secretProvider: &testSecretProvider{returnSecret: map[string]string{"db-password": "hunter2"}},
+	}
+
+	c, err := ij.Config(context.Background())
+	assert.NilError(t, err)
+	return c
+}
+
+func TestConfig(t *testing.T) {
+	c := newTestConfig(t)
+
+	s, err := c.String("HOST")
+	assert.NilError(t, err)
+	assert.Equal(t, s, "localhost")
+
+	i, err := c.Int("PORT")
+	assert.NilError(t, err)
+	assert.Equal(t, i, 8080)
+
+	d, err := c.Duration("TIMEOUT")
+	assert.NilError(t, err)
+	assert.Equal(t, d, 90*time.Second)
+
+	b, err := c.Bool("DEBUG")
+	assert.NilError(t, err)
+	assert.Equal(t, b, true)
+
+	secret, err := c.Secret("DB_PASSWORD")
+	assert.NilError(t, err)
+	assert.Equal(t, secret.Reveal(), "hunter2")
+}
+
+func TestConfigDefaults(t *testing.T) {
+	c := newTestConfig(t)
+
+	s, err := c.String("MISSING", "default")
+	assert.NilError(t, err)
+	assert.Equal(t, s, "default")
+
+	i, err := c.Int("MISSING", 5432)
+	assert.NilError(t, err)
+	assert.Equal(t, i, 5432)
+
+	d, err := c.Duration("MISSING", time.Second)
+	assert.NilError(t, err)
+	assert.Equal(t, d, time.Second)
+
+	b, err := c.Bool("MISSING", true)
+	assert.NilError(t, err)
+	assert.Equal(t, b, true)
+
+	// defaults are only used for missing keys
+	i, err = c.Int("PORT", 5432)
+	assert.NilError(t, err)
+	assert.Equal(t, i, 8080)
+}
+
+func TestConfigErrors(t *testing.T) {
+	c := newTestConfig(t)
+
+	tt := []struct {
+		name        string
+		get         func() error
+		expectedErr string
+		cause       error
+	}{
+		{
+			name:        "missing string",
+			get:         func() error { _, err := c.String("MISSING"); return err },
+			expectedErr: "serum: config key MISSING: key is not set",
+			cause:       ErrMissingKey,
+		},
+		{
+			name:        "missing secret",
+			get:         func() error { _, err := c.Secret("MISSING"); return err },
+			expectedErr: "serum: config key MISSING: key is not set",
+			cause:       ErrMissingKey,
+		},
+		{
+			name:        "invalid int",
+			get:         func() error { _, err := c.Int("INVALID"); return err },
+			expectedErr: "serum: config key INVALID is not a valid int: invalid syntax",
+			cause:       strconv.ErrSyntax,
+		},
+		{
+			name:        "invalid int with default",
+			get:         func() error { _, err := c.Int("INVALID", 1); return err },
+			expectedErr: "serum: config key INVALID is not a valid int: invalid syntax",
+			cause:       strconv.ErrSyntax,
+		},
+		{
+			name:        "invalid bool",
+			get:         func() error { _, err := c.Bool("INVALID"); return err },
+			expectedErr: "serum: config key INVALID is not a valid bool: invalid syntax",
+			cause:       strconv.ErrSyntax,
+		},
+		{
+			name:        "invalid duration",
+			get:         func() error { _, err := c.Duration("DB_PASSWORD"); return err },
+			expectedErr: "serum: config key DB_PASSWORD is not a valid duration: invalid duration",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.get()
+			assert.Error(t, err, tc.expectedErr)
+
+			var cerr *ConfigError
+			assert.Assert(t, errors.As(err, &cerr))
+			if tc.cause != nil {
+				assert.Assert(t, errors.Is(err, tc.cause))
+			}
+		})
+	}
+}
+
+func TestConfigResolveError(t *testing.T) {
+	ij := &Injector{envVars: &envparser.EnvVars{Secrets: map[string]string{"DB_PASSWORD": "db-password"}}}
+
+	c, err := ij.Config(context.Background())
+	assert.Assert(t, c == nil)
+	assert.ErrorContains(t, err, "secrets were loaded but the SecretProvider is nil")
+}
+
+func TestConfigRotation(t *testing.T) {
+	sp := newRotatingSecretProvider()
+	ij := newRotationInjector(t, sp, false)
+	c, err := ij.Config(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, ij.Inject(context.Background()))
+
+	rotations := watch(t, ij, WatchInterval(10*time.Millisecond))
+
+	// reads are safe while the values are updated
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			_, _ = c.Secret("DB_PASSWORD")
+		}
+	}()
+
+	sp.rotate("db-password", "hunter3")
+	nextRotation(t, rotations)
+	cancel()
+	wg.Wait()
+
+	secret, err := c.Secret("DB_PASSWORD")
+	assert.NilError(t, err)
+	assert.Equal(t, secret.Reveal(), "hunter3")
+
+	// Config returns the same Config
+	again, err := ij.Config(context.Background())
+	assert.NilError(t, err)
+	assert.Assert(t, again == c)
+}
+
+func TestConfigWatchFiles(t *testing.T) {
+	env := filepath.Join(t.TempDir(), ".env")
+	writeEnvFile(t, env, "PORT=8080\nDB_PASSWORD=!{db-password}\n")
+
+	ij, err := NewInjector(FromFile(env), WithSecretProviderFunc(func() (secretprovider.SecretProvider, error) {
+		return &rotatingSecretProvider{secrets: map[string]string{"db-password": "hunter2", "new-password": "hunter3"}}, nil
+	}))
+	assert.NilError(t, err)
+	c, err := ij.Config(context.Background())
+	assert.NilError(t, err)
+
+	changes, _ := watchFiles(t, ij)
+	writeEnvFile(t, env, "PORT=9090\nDB_PASSWORD=!{new-password}\n")
+	nextChange(t, changes)
+
+	port, err := c.Int("PORT")
+	assert.NilError(t, err)
+	assert.Equal(t, port, 9090)
+	secret, err := c.Secret("DB_PASSWORD")
+	assert.NilError(t, err)
+	assert.Equal(t, secret.Reveal(), "hunter3")
+}
+
+// gatedSecretProvider blocks the first Decrypt after a release channel is sent to gate, until
+// the release channel is closed.
+type gatedSecretProvider struct {
+	*notifyingSecretProvider
+	gate    chan chan struct{}
+	entered chan struct{}
+}
+
+func (gs *gatedSecretProvider) Decrypt(ctx context.Context, secret string) (string, error) {
+	select {
+	case release := <-gs.gate:
+		gs.entered <- struct{}{}
+		<-release
+	default:
+	}
+	return gs.notifyingSecretProvider.Decrypt(ctx, secret)
+}
+
+func TestConfigWatchAndWatchFiles(t *testing.T) {
+	env := filepath.Join(t.TempDir(), ".env")
+	writeEnvFile(t, env, "PORT=8080\nDB_PASSWORD=!{db-password}\n")
+
+	sp := &rotatingSecretProvider{secrets: map[string]string{"db-password": "hunter2"}, notify: make(chan string)}
+	gs := &gatedSecretProvider{
+		notifyingSecretProvider: &notifyingSecretProvider{sp},
+		gate:                    make(chan chan struct{}, 1),
+		entered:                 make(chan struct{}),
+	}
+	ij, err := NewInjector(FromFile(env), WithSecretProviderFunc(func() (secretprovider.SecretProvider, error) {
+		return gs, nil
+	}))
+	assert.NilError(t, err)
+	c, err := ij.Config(context.Background())
+	assert.NilError(t, err)
+
+	watch(t, ij)
+	changes, _ := watchFiles(t, ij)
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		ij.mu.Lock()
+		defer ij.mu.Unlock()
+		if ij.decrypted == nil {
+			return poll.Continue("secrets not decrypted by Watch yet")
+		}
+		return poll.Success()
+	})
+
+	// a rotation check of the loaded env vars is blocked while the files are reloaded
+	release := make(chan struct{})
+	gs.gate <- release
+	sp.rotate("db-password", "hunter3")
+	sp.notify <- "db-password"
+	<-gs.entered
+	writeEnvFile(t, env, "HOST=localhost\nDB_PASSWORD=!{db-password}\n")
+	nextChange(t, changes)
+
+	// the second notification is only received once the blocked check returned
+	close(release)
+	sp.notify <- "db-password"
+	sp.notify <- "db-password"
+
+	// the check of the replaced env vars does not bring back their keys
+	_, err = c.String("PORT")
+	assert.Assert(t, errors.Is(err, ErrMissingKey))
+	host, err := c.String("HOST")
+	assert.NilError(t, err)
+	assert.Equal(t, host, "localhost")
+	secret, err := c.Secret("DB_PASSWORD")
+	assert.NilError(t, err)
+	assert.Equal(t, secret.Reveal(), "hunter3")
+}
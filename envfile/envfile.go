@@ -0,0 +1,463 @@
+// Package envfile parses .env files into a document model that can be edited and written back.
+// Unlike serum's loaders, which only keep the parsed key/value pairs, a Document keeps the
+// comments, blank lines, ordering, spacing and quoting of a file, along with the position of
+// every node, so tooling can format, rewrite and migrate .env files safely.
+//
+// Values are parsed with the same rules as the loaders: the quotes of multiline values are
+// removed, single line values are kept as written, including any quotes.
+package envfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/wingocard/serum/internal/envparser"
+)
+
+const kvSeparator = "="
+
+// Position is the location of a node in the parsed file.
+type Position struct {
+	// Offset is the 0-based byte offset.
+	Offset int
+	// Line is the 1-based line number.
+	Line int
+	// Column is the 1-based byte column.
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Node is a Blank line, a Comment or an Entry of a Document.
+type Node interface {
+	// Pos returns the position of the node in the parsed file. Nodes created or
+	// edited after parsing keep the position they were parsed at.
+	Pos() Position
+	write(b *bytes.Buffer, newline string)
+}
+
+// Blank is an empty line or a line that only contains whitespace.
+type Blank struct {
+	Position Position
+	// Text is the whitespace of the line.
+	Text       string
+	LineEnding string
+}
+
+// Pos implements Node.
+func (n *Blank) Pos() Position {
+	return n.Position
+}
+
+func (n *Blank) write(b *bytes.Buffer, _ string) {
+	b.WriteString(n.Text)
+	b.WriteString(n.LineEnding)
+}
+
+// Comment is a line starting with #.
+type Comment struct {
+	Position Position
+	// Text is the line, including its indentation and the # prefix.
+	Text       string
+	LineEnding string
+}
+
+// Pos implements Node.
+func (n *Comment) Pos() Position {
+	return n.Position
+}
+
+func (n *Comment) write(b *bytes.Buffer, _ string) {
+	b.WriteString(n.Text)
+	b.WriteString(n.LineEnding)
+}
+
+// Quote is the quoting style a value was parsed with.
+type Quote int
+
+// Supported quoting styles.
+const (
+	// QuoteNone is a single line value written as is.
+	QuoteNone Quote = iota
+	// QuoteDouble is a multiline value surrounded by double quotes.
+	QuoteDouble
+)
+
+// Kind is the kind of value of an Entry.
+type Kind int
+
+// Kinds of values.
+const (
+	// Plain is a plain text value.
+	Plain Kind = iota
+	// Secret is a !{} secret reference.
+	Secret
+	// FileSecret is a !file{} secret reference.
+	FileSecret
+)
+
+// Entry is a key/value pair. Multiline values span more than one line.
+type Entry struct {
+	Position Position
+	// Indent is the whitespace before the key.
+	Indent string
+	Key    string
+	// Separator is the = separator and the spacing around it.
+	Separator string
+	// Value is the parsed value, e.g. !{ref} for secrets.
+	Value string
+	// Quote is the quoting style the value was parsed with. It is read-only metadata, the
+	// writer ignores it: values containing newlines are always written double quoted and other
+	// values are always written as is, so a Value is always parsed back unchanged.
+	Quote      Quote
+	LineEnding string
+
+	// raw and parsed are the text of the entry and the entry as it was parsed, so unchanged
+	// entries are written back byte for byte
+	raw    string
+	parsed *Entry
+}
+
+// Pos implements Node.
+func (n *Entry) Pos() Position {
+	return n.Position
+}
+
+// Kind returns the kind of the entry's value.
+func (n *Entry) Kind() Kind {
+	_, file, ok := envparser.SecretReference(n.Value)
+	switch {
+	case !ok:
+		return Plain
+	case file:
+		return FileSecret
+	default:
+		return Secret
+	}
+}
+
+// Reference returns the secret reference of a Secret or FileSecret entry, the value
+// between the braces.
+func (n *Entry) Reference() (string, bool) {
+	ref, _, ok := envparser.SecretReference(n.Value)
+	return ref, ok
+}
+
+// Lines returns the number of lines the entry spans in the parsed file.
+func (n *Entry) Lines() int {
+	if n.raw == "" {
+		return 1
+	}
+
+	return strings.Count(strings.TrimRight(n.raw, "\r\n"), "\n") + 1
+}
+
+func (n *Entry) unchanged() bool {
+	if n.parsed == nil {
+		return false
+	}
+
+	p := n.parsed
+	return n.Indent == p.Indent && n.Key == p.Key && n.Separator == p.Separator && n.Value == p.Value &&
+		n.LineEnding == p.LineEnding
+}
+
+func (n *Entry) write(b *bytes.Buffer, newline string) {
+	if n.unchanged() {
+		b.WriteString(n.raw)
+		return
+	}
+
+	sep := n.Separator
+	if !strings.Contains(sep, kvSeparator) {
+		sep = kvSeparator
+	}
+
+	b.WriteString(n.Indent)
+	b.WriteString(n.Key)
+	b.WriteString(sep)
+	if strings.Contains(n.Value, "\n") {
+		nl := n.LineEnding
+		if nl == "" {
+			nl = newline
+		}
+		b.WriteString(`"` + strings.ReplaceAll(n.Value, "\n", nl) + `"`)
+	} else {
+		b.WriteString(n.Value)
+	}
+	b.WriteString(n.LineEnding)
+}
+
+// Document is a parsed .env file. Nodes can be edited, added, removed and reordered
+// directly, or using the Set and Delete methods.
+type Document struct {
+	Nodes []Node
+	// Newline is the line ending used for new lines, \r\n if the parsed file used it, \n otherwise.
+	Newline string
+}
+
+// ParseFile parses the .env file at path.
+func ParseFile(path string) (*Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("envfile: error opening file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	d, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s", err, path)
+	}
+	return d, nil
+}
+
+// Parse parses the .env file read from r. Invalid lines and unterminated multiline
+// values return an error, the position of invalid lines is included in the error.
+func Parse(r io.Reader) (*Document, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("envfile: error reading file: %w", err)
+	}
+
+	d := &Document{Newline: "\n"}
+	if bytes.Contains(data, []byte("\r\n")) {
+		d.Newline = "\r\n"
+	}
+
+	var (
+		lp      envparser.LineParser
+		current *Entry
+		pos     = Position{Line: 1, Column: 1}
+	)
+	for _, line := range splitLines(string(data)) {
+		text := strings.TrimRight(line, "\r\n")
+		ending := line[len(text):]
+		_, wasMultiline := lp.Multiline()
+
+		key, value, ok, err := lp.Parse(text)
+		if err != nil {
+			return nil, &SyntaxError{Position: pos, Err: err}
+		}
+		_, isMultiline := lp.Multiline()
+
+		switch {
+		case wasMultiline:
+			// blank and comment lines are part of the value, even though they are skipped
+			current.raw += line
+			if ok {
+				current.Value = value
+				current.LineEnding = ending
+				current.snapshot()
+				current = nil
+			}
+		case isMultiline:
+			current = newEntry(pos, text, ending, "", QuoteDouble)
+			current.raw = line
+			d.Nodes = append(d.Nodes, current)
+		case ok:
+			e := newEntry(pos, text, ending, value, QuoteNone)
+			if e.Key != key {
+				return nil, &SyntaxError{Position: pos, Err: fmt.Errorf("unexpected key %q", key)}
+			}
+			e.raw = line
+			e.snapshot()
+			d.Nodes = append(d.Nodes, e)
+		case strings.TrimSpace(text) == "":
+			d.Nodes = append(d.Nodes, &Blank{Position: pos, Text: text, LineEnding: ending})
+		default:
+			d.Nodes = append(d.Nodes, &Comment{Position: pos, Text: text, LineEnding: ending})
+		}
+
+		pos.Offset += len(line)
+		pos.Line++
+	}
+	if current != nil {
+		return nil, &SyntaxError{
+			Position: current.Position,
+			Err:      fmt.Errorf("multiline value of %s is never terminated", current.Key),
+		}
+	}
+
+	return d, nil
+}
+
+// newEntry returns the entry of the first line of a key/value pair.
+func newEntry(pos Position, text, ending, value string, quote Quote) *Entry {
+	rest := strings.TrimLeft(text, " \t")
+	indent := text[:len(text)-len(rest)]
+
+	i := strings.Index(rest, kvSeparator)
+	key := strings.TrimRight(rest[:i], " \t")
+	valueStart := i + len(kvSeparator)
+	for valueStart < len(rest) && (rest[valueStart] == ' ' || rest[valueStart] == '\t') {
+		valueStart++
+	}
+
+	pos.Column += len(indent)
+	pos.Offset += len(indent)
+	return &Entry{
+		Position:   pos,
+		Indent:     indent,
+		Key:        key,
+		Separator:  rest[len(key):valueStart],
+		Value:      value,
+		Quote:      quote,
+		LineEnding: ending,
+	}
+}
+
+func (n *Entry) snapshot() {
+	parsed := *n
+	n.parsed = &parsed
+}
+
+// splitLines splits s into lines that keep their line endings.
+func splitLines(s string) []string {
+	var lines []string
+	for s != "" {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+
+	return lines
+}
+
+// SyntaxError is returned by Parse for invalid lines.
+type SyntaxError struct {
+	Position Position
+	Err      error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("envfile: syntax error at line %d: %s", e.Position.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// Bytes returns the contents of the .env file. Unchanged nodes are written exactly as they were parsed.
+func (d *Document) Bytes() []byte {
+	newline := d.Newline
+	if newline == "" {
+		newline = "\n"
+	}
+
+	var b bytes.Buffer
+	for i, n := range d.Nodes {
+		n.write(&b, newline)
+		// nodes must be terminated by a newline for the next node to start on its own line
+		if i < len(d.Nodes)-1 && b.Len() > 0 && b.Bytes()[b.Len()-1] != '\n' {
+			b.WriteString(newline)
+		}
+	}
+
+	return b.Bytes()
+}
+
+// WriteTo writes the contents of the .env file to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(d.Bytes())
+	return int64(n), err
+}
+
+// Entries returns the entries of the document in order.
+func (d *Document) Entries() []*Entry {
+	var entries []*Entry
+	for _, n := range d.Nodes {
+		if e, ok := n.(*Entry); ok {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// Get returns the entry of key. When a key is defined more than once the last
+// definition is returned, like the loaders do.
+func (d *Document) Get(key string) (*Entry, bool) {
+	for i := len(d.Nodes) - 1; i >= 0; i-- {
+		if e, ok := d.Nodes[i].(*Entry); ok && e.Key == key {
+			return e, true
+		}
+	}
+
+	return nil, false
+}
+
+// Set sets the value of key, as it is written in the file, e.g. !{ref} for a secret.
+// Existing entries keep their indentation and separator, when a key is defined more than
+// once its last definition is changed. New keys are appended to the end of the document.
+// Set returns an error, leaving the document unchanged, if the value would not be parsed
+// back as is, e.g. values with leading spaces.
+func (d *Document) Set(key, value string) error {
+	if key == "" || strings.ContainsAny(key, "=\r\n \t") || strings.HasPrefix(key, "#") {
+		return fmt.Errorf("envfile: invalid key %q", key)
+	}
+
+	nodes := append([]Node(nil), d.Nodes...)
+	e, ok := d.Get(key)
+	if ok {
+		edited := *e
+		edited.Value = value
+		edited.Quote = QuoteNone
+		if strings.Contains(value, "\n") {
+			edited.Quote = QuoteDouble
+		}
+		for i := range nodes {
+			if nodes[i] == e {
+				nodes[i] = &edited
+			}
+		}
+	} else {
+		nodes = append(nodes, &Entry{Key: key, Separator: kvSeparator, Value: value, LineEnding: d.newline()})
+	}
+
+	// verify the value is parsed back as is
+	edited := &Document{Nodes: nodes, Newline: d.Newline}
+	parsed, err := Parse(bytes.NewReader(edited.Bytes()))
+	if err != nil {
+		return fmt.Errorf("envfile: value of %s can not be written to a .env file: %w", key, err)
+	}
+	if pe, _ := parsed.Get(key); pe.Value != value {
+		return fmt.Errorf("envfile: value of %s can not be written to a .env file", key)
+	}
+
+	d.Nodes = nodes
+	return nil
+}
+
+// Delete removes every definition of key and reports whether key was defined.
+func (d *Document) Delete(key string) bool {
+	nodes := make([]Node, 0, len(d.Nodes))
+	deleted := false
+	for _, n := range d.Nodes {
+		if e, ok := n.(*Entry); ok && e.Key == key {
+			deleted = true
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	d.Nodes = nodes
+
+	return deleted
+}
+
+func (d *Document) newline() string {
+	if d.Newline == "" {
+		return "\n"
+	}
+	return d.Newline
+}
@@ -0,0 +1,358 @@
+package envfile
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wingocard/serum/internal/envparser"
+	"gotest.tools/v3/assert"
+)
+
+type badReader struct{}
+
+func (b *badReader) Read(p []byte) (int, error) {
+	return 0, errors.New("bad read")
+}
+
+const envFile = `# database
+DB_HOST=localhost
+  DB_PORT = 5432
+
+DB_PASSWORD=!{db-password}
+JWT_KEY="-----BEGIN PUBLIC KEY-----
+MIGbMBAGByqGSM49AgEGBSuBBAAjA4GGAAQAC6vH7IGAp8pdUt92yiDGKt9mAwN3
+
+# not a comment, skipped by the parser
+-----END PUBLIC KEY-----"
+#DB_HOST=commented
+DB_HOST=127.0.0.1
+CERT=!file{tls#.cert}
+LAST=no newline`
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		name    string
+		envFile string
+	}{
+		{name: "env file", envFile: envFile},
+		{name: "crlf", envFile: strings.ReplaceAll(envFile, "\n", "\r\n")},
+		{name: "trailing newline", envFile: envFile + "\n"},
+		{name: "empty", envFile: ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tc.envFile))
+			assert.NilError(t, err)
+			assert.Equal(t, string(doc.Bytes()), tc.envFile)
+
+			env, err := envparser.Parse(strings.NewReader(tc.envFile))
+			assert.NilError(t, err)
+			for k, v := range env.Plain {
+				e, ok := doc.Get(k)
+				assert.Assert(t, ok)
+				assert.Equal(t, e.Value, v)
+				assert.Equal(t, e.Kind(), Plain)
+			}
+			for k, v := range env.Secrets {
+				e, ok := doc.Get(k)
+				assert.Assert(t, ok)
+				ref, ok := e.Reference()
+				assert.Assert(t, ok)
+				assert.Equal(t, ref, v)
+			}
+		})
+	}
+}
+
+func TestParseNodes(t *testing.T) {
+	doc, err := Parse(strings.NewReader(envFile))
+	assert.NilError(t, err)
+	assert.Equal(t, len(doc.Nodes), 10)
+	assert.Equal(t, doc.Newline, "\n")
+
+	comment, ok := doc.Nodes[0].(*Comment)
+	assert.Assert(t, ok)
+	assert.Equal(t, comment.Text, "# database")
+	assert.Equal(t, comment.LineEnding, "\n")
+
+	port, ok := doc.Nodes[2].(*Entry)
+	assert.Assert(t, ok)
+	assert.Equal(t, port.Pos(), Position{Offset: 31, Line: 3, Column: 3})
+	assert.Equal(t, port.Indent, "  ")
+	assert.Equal(t, port.Key, "DB_PORT")
+	assert.Equal(t, port.Separator, " = ")
+	assert.Equal(t, port.Value, "5432")
+	assert.Equal(t, port.Quote, QuoteNone)
+
+	_, ok = doc.Nodes[3].(*Blank)
+	assert.Assert(t, ok)
+
+	jwt, ok := doc.Nodes[5].(*Entry)
+	assert.Assert(t, ok)
+	assert.Equal(t, jwt.Pos().Line, 6)
+	assert.Equal(t, jwt.Lines(), 5)
+	assert.Equal(t, jwt.Quote, QuoteDouble)
+	assert.Equal(t, jwt.Value, "-----BEGIN PUBLIC KEY-----\n"+
+		"MIGbMBAGByqGSM49AgEGBSuBBAAjA4GGAAQAC6vH7IGAp8pdUt92yiDGKt9mAwN3\n"+
+		"-----END PUBLIC KEY-----")
+
+	host, ok := doc.Nodes[7].(*Entry)
+	assert.Assert(t, ok)
+	assert.Equal(t, host.Pos().Line, 12)
+	e, ok := doc.Get("DB_HOST")
+	assert.Assert(t, ok)
+	assert.Assert(t, e == host)
+
+	cert, _ := doc.Get("CERT")
+	assert.Equal(t, cert.Kind(), FileSecret)
+	password, _ := doc.Get("DB_PASSWORD")
+	assert.Equal(t, password.Kind(), Secret)
+
+	keys := []string{}
+	for _, e := range doc.Entries() {
+		keys = append(keys, e.Key)
+	}
+	assert.DeepEqual(t, keys, []string{"DB_HOST", "DB_PORT", "DB_PASSWORD", "JWT_KEY", "DB_HOST", "CERT", "LAST"})
+}
+
+func TestParseError(t *testing.T) {
+	tt := []struct {
+		name        string
+		envFile     string
+		expectedErr string
+		line        int
+	}{
+		{
+			name:        "invalid line",
+			envFile:     "DB_HOST=localhost\nBAD_VALUE\n",
+			expectedErr: `syntax error at line 2: invalid format "BAD_VALUE"`,
+			line:        2,
+		},
+		{
+			name:        "unterminated multiline value",
+			envFile:     "A=b\nKEY=\"line1\nline2\n",
+			expectedErr: "multiline value of KEY is never terminated",
+			line:        2,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tc.envFile))
+			assert.Assert(t, doc == nil)
+			assert.ErrorContains(t, err, tc.expectedErr)
+
+			var serr *SyntaxError
+			assert.Assert(t, errors.As(err, &serr))
+			assert.Equal(t, serr.Position.Line, tc.line)
+		})
+	}
+
+	_, err := Parse(&badReader{})
+	assert.ErrorContains(t, err, "error reading file")
+}
+
+func TestParseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	assert.NilError(t, ioutil.WriteFile(path, []byte(envFile), 0600))
+
+	doc, err := ParseFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(doc.Bytes()), envFile)
+
+	_, err = ParseFile(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorContains(t, err, "error opening file")
+}
+
+func TestWriteTo(t *testing.T) {
+	doc, err := Parse(strings.NewReader(envFile))
+	assert.NilError(t, err)
+
+	var b bytes.Buffer
+	n, err := doc.WriteTo(&b)
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(len(envFile)))
+	assert.Equal(t, b.String(), envFile)
+}
+
+func TestEditNodes(t *testing.T) {
+	doc, err := Parse(strings.NewReader("# db\n  DB_HOST = localhost\nDB_PORT=5432\n"))
+	assert.NilError(t, err)
+
+	e, _ := doc.Get("DB_HOST")
+	e.Indent = ""
+	e.Separator = "="
+	doc.Nodes[0].(*Comment).Text = "# database"
+	doc.Nodes = append(doc.Nodes, &Blank{LineEnding: "\n"}, &Entry{Key: "DEBUG", Value: "true", LineEnding: "\n"})
+
+	assert.Equal(t, string(doc.Bytes()), "# database\nDB_HOST=localhost\nDB_PORT=5432\n\nDEBUG=true\n")
+}
+
+func TestEditQuote(t *testing.T) {
+	doc, err := Parse(strings.NewReader("DB_HOST=localhost\nKEY=\"line1\nline2\"\n"))
+	assert.NilError(t, err)
+
+	// the quoting style is not used by the writer, values are written so they are parsed back as is
+	host, _ := doc.Get("DB_HOST")
+	host.Quote = QuoteDouble
+	host.Value = "127.0.0.1"
+	key, _ := doc.Get("KEY")
+	key.Quote = QuoteNone
+	key.Value = "line1\nline3"
+
+	assert.Equal(t, string(doc.Bytes()), "DB_HOST=127.0.0.1\nKEY=\"line1\nline3\"\n")
+}
+
+func TestDocumentSet(t *testing.T) {
+	tt := []struct {
+		name     string
+		envFile  string
+		key      string
+		value    string
+		expected string
+	}{
+		{
+			name:     "update",
+			envFile:  "# db\nDB_HOST=localhost\nDB_PORT=5432\n",
+			key:      "DB_HOST",
+			value:    "127.0.0.1",
+			expected: "# db\nDB_HOST=127.0.0.1\nDB_PORT=5432\n",
+		},
+		{
+			name:     "keep spacing",
+			envFile:  "  DB_PORT = 5432\n",
+			key:      "DB_PORT",
+			value:    "5433",
+			expected: "  DB_PORT = 5433\n",
+		},
+		{
+			name:     "update last definition",
+			envFile:  "DB_HOST=localhost\nDB_HOST=127.0.0.1\n",
+			key:      "DB_HOST",
+			value:    "db",
+			expected: "DB_HOST=localhost\nDB_HOST=db\n",
+		},
+		{
+			name:     "plain to secret",
+			envFile:  "DB_PASSWORD=hunter2\n",
+			key:      "DB_PASSWORD",
+			value:    "!{db-password}",
+			expected: "DB_PASSWORD=!{db-password}\n",
+		},
+		{
+			name:     "add",
+			envFile:  "DB_HOST=localhost\n",
+			key:      "DB_PORT",
+			value:    "5432",
+			expected: "DB_HOST=localhost\nDB_PORT=5432\n",
+		},
+		{
+			name:     "add without trailing newline",
+			envFile:  "DB_HOST=localhost",
+			key:      "DB_PORT",
+			value:    "5432",
+			expected: "DB_HOST=localhost\nDB_PORT=5432\n",
+		},
+		{
+			name:     "add to empty file",
+			key:      "DB_PORT",
+			value:    "5432",
+			expected: "DB_PORT=5432\n",
+		},
+		{
+			name:     "add crlf",
+			envFile:  "DB_HOST=localhost\r\n",
+			key:      "KEY",
+			value:    "line1\nline2",
+			expected: "DB_HOST=localhost\r\nKEY=\"line1\r\nline2\"\r\n",
+		},
+		{
+			name:     "multiline to single line",
+			envFile:  "KEY=\"line1\nline2\"\nDB_HOST=localhost",
+			key:      "KEY",
+			value:    "value",
+			expected: "KEY=value\nDB_HOST=localhost",
+		},
+		{
+			name:     "single line to multiline",
+			envFile:  "KEY=value\n",
+			key:      "KEY",
+			value:    "line1\nline2",
+			expected: "KEY=\"line1\nline2\"\n",
+		},
+		{
+			name:     "empty value",
+			envFile:  "KEY=value\n",
+			key:      "KEY",
+			value:    "",
+			expected: "KEY=\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tc.envFile))
+			assert.NilError(t, err)
+
+			assert.NilError(t, doc.Set(tc.key, tc.value))
+			assert.Equal(t, string(doc.Bytes()), tc.expected)
+			e, ok := doc.Get(tc.key)
+			assert.Assert(t, ok)
+			assert.Equal(t, e.Value, tc.value)
+		})
+	}
+}
+
+func TestDocumentSetError(t *testing.T) {
+	tt := []struct {
+		name        string
+		key         string
+		value       string
+		expectedErr string
+	}{
+		{name: "empty key", key: "", value: "v", expectedErr: `invalid key ""`},
+		{name: "key with separator", key: "A=B", value: "v", expectedErr: `invalid key "A=B"`},
+		{name: "key with spaces", key: " KEY", value: "v", expectedErr: `invalid key " KEY"`},
+		{name: "comment key", key: "#KEY", value: "v", expectedErr: `invalid key "#KEY"`},
+		{name: "leading space", key: "KEY", value: " v", expectedErr: "value of KEY can not be written"},
+		{name: "unterminated quote", key: "KEY", value: `"v`, expectedErr: "value of KEY can not be written"},
+		{name: "empty secret", key: "KEY", value: "!{}", expectedErr: "value of KEY can not be written"},
+		{name: "multiline blank line", key: "KEY", value: "line1\n\nline2", expectedErr: "value of KEY can not be written"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			envFile := "KEY=value\n"
+			doc, err := Parse(strings.NewReader(envFile))
+			assert.NilError(t, err)
+
+			err = doc.Set(tc.key, tc.value)
+			assert.ErrorContains(t, err, tc.expectedErr)
+			assert.Equal(t, string(doc.Bytes()), envFile)
+		})
+	}
+}
+
+func TestDocumentDelete(t *testing.T) {
+	doc, err := Parse(strings.NewReader(envFile))
+	assert.NilError(t, err)
+
+	assert.Assert(t, doc.Delete("DB_HOST"))
+	assert.Assert(t, doc.Delete("JWT_KEY"))
+	assert.Assert(t, !doc.Delete("MISSING"))
+	assert.Equal(t, string(doc.Bytes()), `# database
+  DB_PORT = 5432
+
+DB_PASSWORD=!{db-password}
+#DB_HOST=commented
+CERT=!file{tls#.cert}
+LAST=no newline`)
+
+	_, ok := doc.Get("DB_HOST")
+	assert.Assert(t, !ok)
+}
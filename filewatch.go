@@ -0,0 +1,204 @@
+package serum
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/wingocard/serum/internal/envparser"
+)
+
+const defaultDebounce = 100 * time.Millisecond
+
+// WatchDebounce sets how long WatchFiles waits for the watched files to stop changing before
+// parsing them again, so the bursts of writes of editors are parsed once. It defaults to 100ms.
+func WatchDebounce(d time.Duration) WatchOption {
+	return func(w *watcher) {
+		w.debounce = d
+	}
+}
+
+// Change is the set of keys that were added, removed or modified when watched .env files
+// changed. A key is modified when its value changes or when it changes from a plain text
+// variable to a secret, or back. The keys are sorted.
+type Change struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// ChangeFunc is called by Injector.WatchFiles when watched .env files change.
+type ChangeFunc func(c Change)
+
+// OnChange registers f to be called by WatchFiles when the keys of the watched .env files change.
+func (ij *Injector) OnChange(f ChangeFunc) {
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+
+	ij.changeFuncs = append(ij.changeFuncs, f)
+}
+
+// WatchFiles watches the .env files loaded using FromFile or FromFiles and parses them again when they
+// are written. When their keys change, the env vars of the Injector are replaced, so the next Inject
+// or Resolve uses them, and the ChangeFuncs registered using OnChange are called with the keys that
+// changed. Files that fail to parse are reported to the function set using WatchErrors and the last
+// env vars that parsed successfully are kept. WatchFiles blocks until ctx is done and returns ctx's error.
+func (ij *Injector) WatchFiles(ctx context.Context, options ...WatchOption) error {
+	w := newWatcher(options)
+	if len(ij.sourceFiles) == 0 {
+		return fmt.Errorf("serum: error watching files: the env vars were not loaded from files")
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("serum: error watching files: %w", err)
+	}
+	defer fw.Close()
+
+	// the directories are watched, editors often replace files instead of writing them
+	files := make(map[string]bool, len(ij.sourceFiles))
+	for _, path := range ij.sourceFiles {
+		path = filepath.Clean(path)
+		files[path] = true
+		if err := fw.Add(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("serum: error watching files: %w", err)
+		}
+	}
+	w.ready()
+
+	debounce := time.NewTimer(w.debounce)
+	stopTimer(debounce)
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-fw.Events:
+			if !ok {
+				return fmt.Errorf("serum: error watching files: watcher closed")
+			}
+			if !files[filepath.Clean(event.Name)] || event.Op == fsnotify.Chmod {
+				continue
+			}
+			// a pending expiry must be drained so a reload is not triggered before the files settle
+			stopTimer(debounce)
+			debounce.Reset(w.debounce)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return fmt.Errorf("serum: error watching files: watcher closed")
+			}
+			w.onError(fmt.Errorf("serum: error watching files: %w", err))
+		case <-debounce.C:
+			if err := ij.reload(ctx); err != nil {
+				w.onError(err)
+			}
+		}
+	}
+}
+
+// stopTimer stops t and drains its channel if it already fired, so t can be Reset.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
+// reload parses the source files again and replaces the env vars when their keys changed.
+// The values of the Config, if any, are resolved again.
+func (ij *Injector) reload(ctx context.Context) error {
+	env, err := parseFiles(ij.sourceFiles)
+	if err != nil {
+		return fmt.Errorf("serum: error reloading env vars: %s", err)
+	}
+
+	ij.mu.Lock()
+	c := diffEnvVars(ij.envVars, env)
+	changed := len(c.Added)+len(c.Removed)+len(c.Modified) > 0
+	if changed {
+		ij.envVars = env
+	}
+	funcs := ij.changeFuncs
+	config := ij.config
+	ij.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	var configErr error
+	if config != nil {
+		configErr = ij.updateConfig(ctx, config, env)
+	}
+	for _, f := range funcs {
+		f(c)
+	}
+
+	return configErr
+}
+
+// updateConfig resolves env and replaces the values of config, unless env was replaced while it
+// was resolved, in which case the reload that replaced it updates config.
+func (ij *Injector) updateConfig(ctx context.Context, config *Config, env *envparser.EnvVars) error {
+	resolved, err := ij.resolve(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+
+	if ij.envVars == env {
+		config.replace(resolved)
+	}
+	return nil
+}
+
+// diffEnvVars returns the keys added, removed and modified between old and new.
+func diffEnvVars(old, new *envparser.EnvVars) Change {
+	var c Change
+	for k, v := range new.Plain {
+		switch o, ok := old.Plain[k]; {
+		case ok && o != v:
+			c.Modified = append(c.Modified, k)
+		case !ok && hasKey(old, k):
+			c.Modified = append(c.Modified, k)
+		case !ok:
+			c.Added = append(c.Added, k)
+		}
+	}
+	for k, v := range new.Secrets {
+		switch o, ok := old.Secrets[k]; {
+		case ok && (o != v || old.Files[k] != new.Files[k]):
+			c.Modified = append(c.Modified, k)
+		case !ok && hasKey(old, k):
+			c.Modified = append(c.Modified, k)
+		case !ok:
+			c.Added = append(c.Added, k)
+		}
+	}
+	for _, vars := range []map[string]string{old.Plain, old.Secrets} {
+		for k := range vars {
+			if !hasKey(new, k) {
+				c.Removed = append(c.Removed, k)
+			}
+		}
+	}
+
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Strings(c.Modified)
+	return c
+}
+
+func hasKey(env *envparser.EnvVars, k string) bool {
+	_, plain := env.Plain[k]
+	_, secret := env.Secrets[k]
+	return plain || secret
+}
@@ -0,0 +1,175 @@
+package serum
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wingocard/serum/internal/envparser"
+	"gotest.tools/v3/assert"
+)
+
+// watchFiles runs WatchFiles until the test ends and returns the changes and errors it reports,
+// once the files are watched.
+func watchFiles(t *testing.T, ij *Injector, options ...WatchOption) (<-chan Change, <-chan error) {
+	t.Helper()
+
+	changes := make(chan Change, 10)
+	errs := make(chan error, 10)
+	ij.OnChange(func(c Change) {
+		changes <- c
+	})
+
+	ready := make(chan struct{})
+	options = append(options,
+		WatchDebounce(20*time.Millisecond),
+		WatchErrors(func(err error) { errs <- err }),
+		func(w *watcher) { w.ready = func() { close(ready) } },
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- ij.WatchFiles(ctx, options...)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.Equal(t, <-done, context.Canceled)
+	})
+
+	select {
+	case <-ready:
+	case err := <-done:
+		t.Fatalf("WatchFiles returned: %s", err)
+	}
+
+	return changes, errs
+}
+
+func nextChange(t *testing.T, changes <-chan Change) Change {
+	t.Helper()
+
+	select {
+	case c := <-changes:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a change")
+		return Change{}
+	}
+}
+
+func writeEnvFile(t *testing.T, path, content string) {
+	t.Helper()
+	assert.NilError(t, ioutil.WriteFile(path, []byte(content), 0600))
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	env := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	writeEnvFile(t, env, "DB_HOST=localhost\nDB_PASSWORD=!{db-password}\nDEBUG=false\n")
+	writeEnvFile(t, local, "DEBUG=true\n")
+
+	ij, err := NewInjector(FromFiles(env, local))
+	assert.NilError(t, err)
+	changes, _ := watchFiles(t, ij)
+
+	// bursts of writes are reported once
+	writeEnvFile(t, env, "DB_HOST=localhost\n")
+	writeEnvFile(t, env, "DB_HOST=127.0.0.1\nDB_PASSWORD=hunter2\nDEBUG=false\n")
+	writeEnvFile(t, env, "DB_HOST=127.0.0.1\nDB_PASSWORD=hunter2\nDEBUG=false\nPORT=8080\n")
+	assert.DeepEqual(t, nextChange(t, changes), Change{
+		Added:    []string{"PORT"},
+		Modified: []string{"DB_HOST", "DB_PASSWORD"},
+	})
+	assert.DeepEqual(t, ij.loaded().Plain, map[string]string{
+		"DB_HOST": "127.0.0.1", "DB_PASSWORD": "hunter2", "DEBUG": "true", "PORT": "8080",
+	})
+
+	// files replaced by a rename are reloaded
+	tmp := filepath.Join(dir, "tmp")
+	writeEnvFile(t, tmp, "")
+	assert.NilError(t, os.Rename(tmp, local))
+	assert.DeepEqual(t, nextChange(t, changes), Change{Modified: []string{"DEBUG"}})
+
+	// writes that don't change the keys are not reported
+	writeEnvFile(t, env, "# comment\nDB_HOST=127.0.0.1\nDB_PASSWORD=hunter2\nDEBUG=false\nPORT=8080\n")
+	writeEnvFile(t, env, "DB_HOST=127.0.0.1\nDEBUG=false\nPORT=8080\n")
+	assert.DeepEqual(t, nextChange(t, changes), Change{Removed: []string{"DB_PASSWORD"}})
+}
+
+func TestWatchFilesParseError(t *testing.T) {
+	env := filepath.Join(t.TempDir(), ".env")
+	writeEnvFile(t, env, "DB_HOST=localhost\n")
+
+	ij, err := NewInjector(FromFile(env))
+	assert.NilError(t, err)
+	changes, errs := watchFiles(t, ij)
+
+	writeEnvFile(t, env, "DB_HOST=127.0.0.1\nBAD_VALUE\n")
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, "serum: error reloading env vars")
+		assert.ErrorContains(t, err, `invalid format "BAD_VALUE"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an error")
+	}
+
+	// the last good env vars are kept
+	assert.DeepEqual(t, ij.loaded().Plain, map[string]string{"DB_HOST": "localhost"})
+
+	writeEnvFile(t, env, "DB_HOST=127.0.0.1\n")
+	assert.DeepEqual(t, nextChange(t, changes), Change{Modified: []string{"DB_HOST"}})
+}
+
+func TestWatchFilesError(t *testing.T) {
+	ij, err := NewInjector(LoaderFunc(func(ij *Injector) error {
+		ij.envVars = envparser.ParseMap(map[string]string{"DB_HOST": "localhost"})
+		return nil
+	}))
+	assert.NilError(t, err)
+
+	err = ij.WatchFiles(context.Background())
+	assert.Error(t, err, "serum: error watching files: the env vars were not loaded from files")
+}
+
+func TestStopTimer(t *testing.T) {
+	timer := time.NewTimer(time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	// the expiry that was not received is drained instead of firing right after the reset
+	stopTimer(timer)
+	timer.Reset(time.Hour)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		t.Fatal("timer fired before its reset duration")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// stopping a stopped timer does not block
+	stopTimer(timer)
+	stopTimer(timer)
+}
+
+func TestDiffEnvVars(t *testing.T) {
+	old := &envparser.EnvVars{
+		Plain:   map[string]string{"SAME": "v", "CHANGED": "v", "TO_SECRET": "v", "REMOVED": "v"},
+		Secrets: map[string]string{"SECRET": "s", "TO_FILE": "f", "TO_PLAIN": "p", "REMOVED_SECRET": "s"},
+	}
+	new := &envparser.EnvVars{
+		Plain:   map[string]string{"SAME": "v", "CHANGED": "w", "TO_PLAIN": "p", "ADDED": "v"},
+		Secrets: map[string]string{"SECRET": "s", "TO_FILE": "f", "TO_SECRET": "v", "ADDED_SECRET": "s"},
+		Files:   map[string]bool{"TO_FILE": true},
+	}
+
+	assert.DeepEqual(t, diffEnvVars(old, new), Change{
+		Added:    []string{"ADDED", "ADDED_SECRET"},
+		Removed:  []string{"REMOVED", "REMOVED_SECRET"},
+		Modified: []string{"CHANGED", "TO_FILE", "TO_PLAIN", "TO_SECRET"},
+	})
+}
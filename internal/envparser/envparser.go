@@ -12,17 +12,23 @@ import (
 )
 
 const (
-	commentToken  = "#"
-	kvSeparator   = "="
-	secretRegex   = `^!{(?P<secretval>.+)}$` //nolint:gosec
-	emptySecret   = "!{}"
-	kvSplitLength = 2
+	commentToken    = "#"
+	kvSeparator     = "="
+	secretRegex     = `^!{(?P<secretval>.+)}$`     //nolint:gosec
+	fileSecretRegex = `^!file{(?P<secretval>.+)}$` //nolint:gosec
+	emptySecret     = "!{}"
+	emptyFileSecret = "!file{}"
+	kvSplitLength   = 2
 )
 
-var secretRe *regexp.Regexp
+var (
+	secretRe     *regexp.Regexp
+	fileSecretRe *regexp.Regexp
+)
 
 func init() {
 	secretRe = regexp.MustCompile(secretRegex)
+	fileSecretRe = regexp.MustCompile(fileSecretRegex)
 }
 
 type fsWrapper interface {
@@ -36,10 +42,12 @@ func (o *osFS) Open(path string) (io.ReadCloser, error) {
 }
 
 // EnvVars contains the plain text key value mappings as well as the encrypted secret key value mappings
-// parsed from an env file.
+// parsed from an env file. Files contains the keys of the secrets declared using !file{}, whose
+// decrypted value is written to a file. It is nil when there are none.
 type EnvVars struct {
 	Plain   map[string]string
 	Secrets map[string]string
+	Files   map[string]bool
 }
 
 // ParseFile parses a .env file at path and returns the key value
@@ -55,18 +63,28 @@ func parseFile(fs fsWrapper, path string) (*EnvVars, error) {
 	}
 	defer f.Close()
 
+	return Parse(f)
+}
+
+// Parse parses .env formatted key/value pairs from r and returns the key value
+// mappings for plain text variables and secret variables.
+func Parse(r io.Reader) (*EnvVars, error) {
 	envVars := &EnvVars{
 		Plain:   make(map[string]string),
 		Secrets: make(map[string]string),
 	}
 
 	var lp lineParser
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if err := lp.parse(envVars, line); err != nil {
+		e, err := lp.parse(line)
+		if err != nil {
 			return nil, fmt.Errorf("error parsing line: %s: %s", line, err)
 		}
+		if e != nil {
+			envVars.addEntry(e)
+		}
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error parsing file: %s", err)
@@ -75,23 +93,78 @@ func parseFile(fs fsWrapper, path string) (*EnvVars, error) {
 	return envVars, nil
 }
 
+// LineParser parses a .env file line by line, with the same rules as Parse. It is used by
+// tooling that needs to know which lines make up each key/value pair.
+type LineParser struct {
+	lp lineParser
+}
+
+// Parse parses a line without its line ending. It returns the key and value when the line
+// completes a key/value pair and ok is false for blank lines, comments and the lines of a
+// multiline value that is not terminated yet.
+func (p *LineParser) Parse(line string) (key, value string, ok bool, err error) {
+	e, err := p.lp.parse(line)
+	if err != nil || e == nil {
+		return "", "", false, err
+	}
+
+	return e.key, e.value, true, nil
+}
+
+// Multiline returns the key of the multiline value being parsed, if any.
+func (p *LineParser) Multiline() (string, bool) {
+	return p.lp.key, p.lp.multiline
+}
+
+// SecretReference returns the reference of a !{} or !file{} secret value and whether it is a
+// !file{} secret. ok is false if v is not a secret.
+func SecretReference(v string) (ref string, file bool, ok bool) {
+	switch {
+	case secretRe.MatchString(v):
+		return secretRe.ReplaceAllString(v, "$secretval"), false, true
+	case fileSecretRe.MatchString(v):
+		return fileSecretRe.ReplaceAllString(v, "$secretval"), true, true
+	default:
+		return "", false, false
+	}
+}
+
+// entry is a key/value pair parsed from a line, or lines, of a .env file.
+type entry struct {
+	key   string
+	value string
+	// multiline values are always plain text
+	multiline bool
+}
+
+// formatError is returned by the lineParser when a line is not a valid key/value pair.
+type formatError struct {
+	line        string
+	emptySecret bool
+}
+
+func (e *formatError) Error() string {
+	return fmt.Sprintf("invalid format %q", e.line)
+}
+
 type lineParser struct {
 	multiline bool
 	key       string
 	value     string
 }
 
-func (p *lineParser) parse(envVars *EnvVars, l string) error {
+// parse parses a line of a .env file and returns the entry it completes, if any.
+func (p *lineParser) parse(l string) (*entry, error) {
 	l = strings.TrimSpace(l)
 	// ignore empty lines
 	if l == "" {
-		return nil
+		return nil, nil
 	}
 
 	// ignore commented line
 	// TODO: ignore inline comments
 	if strings.HasPrefix(l, commentToken) {
-		return nil
+		return nil, nil
 	}
 
 	// handle multiline variables
@@ -100,44 +173,37 @@ func (p *lineParser) parse(envVars *EnvVars, l string) error {
 		if strings.HasSuffix(l, `"`) {
 			p.value += strings.TrimSuffix(l, `"`)
 			p.multiline = false
-			envVars.Plain[p.key] = p.value
-			return nil
+			return &entry{key: p.key, value: p.value, multiline: true}, nil
 		}
 		p.value += fmt.Sprintf("%s\n", l)
-		return nil
+		return nil, nil
 	}
 
 	// split line into two pieces (k,v) based on key value separator
 	splits := strings.SplitN(l, kvSeparator, kvSplitLength)
 	if len(splits) != kvSplitLength {
-		return fmt.Errorf("invalid format %q", l)
+		return nil, &formatError{line: l}
 	}
 
 	// key is first index, value is second
 	k := strings.TrimSpace(splits[0])
 	v := strings.TrimSpace(splits[1])
-	if k == "" || v == emptySecret {
-		return fmt.Errorf("invalid format %q", l)
+	if k == "" {
+		return nil, &formatError{line: l}
 	}
-
-	// check if value is encrypted secret
-	if secretRe.MatchString(v) {
-		// fill in secret value - replace template value with capture group "secretval"
-		envVars.Secrets[k] = secretRe.ReplaceAllString(v, "$secretval")
-		return nil
+	if v == emptySecret || v == emptyFileSecret {
+		return nil, &formatError{line: l, emptySecret: true}
 	}
 
 	// check if value is the beginning of a multiline variable
-	if strings.HasPrefix(v, `"`) && !strings.HasSuffix(v, `"`) {
+	if !isSecret(v) && strings.HasPrefix(v, `"`) && !strings.HasSuffix(v, `"`) {
 		p.multiline = true
 		p.key = k
 		p.value = fmt.Sprintf("%s\n", strings.TrimPrefix(v, `"`))
-		return nil
+		return nil, nil
 	}
 
-	// not a secret, fill in plain text value
-	envVars.Plain[k] = v
-	return nil
+	return &entry{key: k, value: v}, nil
 }
 
 // ParseEnv parses the process' environment for the specified
@@ -155,16 +221,88 @@ func ParseEnv(keys []string) (*EnvVars, error) {
 			return nil, fmt.Errorf("env variable %q not found", k)
 		}
 
-		// check if value is encrypted secret
-		if secretRe.MatchString(v) {
-			// fill in secret value - replace template value with capture group "secretval"
-			envVars.Secrets[k] = secretRe.ReplaceAllString(v, "$secretval")
-			continue
+		envVars.add(k, v)
+	}
+
+	return envVars, nil
+}
+
+// ParseMap parses the key/value pairs in vars and returns the key value
+// mappings for plain text variables and secret variables.
+func ParseMap(vars map[string]string) *EnvVars {
+	envVars := &EnvVars{
+		Plain:   make(map[string]string),
+		Secrets: make(map[string]string),
+	}
+
+	for k, v := range vars {
+		envVars.add(k, v)
+	}
+
+	return envVars
+}
+
+// Merge adds the variables in o to e. Variables already in e are replaced by the ones
+// in o, whether they are plain text variables or secrets.
+func (e *EnvVars) Merge(o *EnvVars) {
+	for k, v := range o.Plain {
+		delete(e.Secrets, k)
+		delete(e.Files, k)
+		e.Plain[k] = v
+	}
+
+	for k, v := range o.Secrets {
+		delete(e.Plain, k)
+		delete(e.Files, k)
+		e.Secrets[k] = v
+		if o.Files[k] {
+			if e.Files == nil {
+				e.Files = make(map[string]bool)
+			}
+			e.Files[k] = true
 		}
+	}
+}
 
-		// not a secret, fill in plain text value
-		envVars.Plain[k] = v
+func (e *EnvVars) addEntry(en *entry) {
+	if en.multiline {
+		e.Plain[en.key] = en.value
+		return
 	}
 
-	return envVars, nil
+	e.add(en.key, en.value)
+}
+
+func isSecret(v string) bool {
+	return secretRe.MatchString(v) || fileSecretRe.MatchString(v)
+}
+
+func (e *EnvVars) add(k, v string) {
+	// check if value is encrypted secret
+	if e.addSecret(k, v) {
+		return
+	}
+
+	// not a secret, fill in plain text value
+	e.Plain[k] = v
+}
+
+// addSecret adds v to the secrets if it is a !{} or !file{} secret and reports whether it was added.
+func (e *EnvVars) addSecret(k, v string) bool {
+	switch {
+	case secretRe.MatchString(v):
+		// fill in secret value - replace template value with capture group "secretval"
+		e.Secrets[k] = secretRe.ReplaceAllString(v, "$secretval")
+		delete(e.Files, k)
+	case fileSecretRe.MatchString(v):
+		e.Secrets[k] = fileSecretRe.ReplaceAllString(v, "$secretval")
+		if e.Files == nil {
+			e.Files = make(map[string]bool)
+		}
+		e.Files[k] = true
+	default:
+		return false
+	}
+
+	return true
 }
@@ -203,6 +203,13 @@ func TestParseFileError(t *testing.T) {
 			`,
 			expectedErr: errors.New("invalid format"),
 		},
+		{
+			name: "empty file secret",
+			envFile: `
+				SECRET=!file{}
+			`,
+			expectedErr: errors.New("invalid format"),
+		},
 	}
 
 	for _, tc := range tt {
@@ -220,6 +227,33 @@ func TestParseFileError(t *testing.T) {
 	}
 }
 
+func TestParseFileSecrets(t *testing.T) {
+	envFile := `
+		PLAIN=plaintext
+		SECRET=!{keep it secret}
+		TLS_KEY=!file{tls-key}
+		CREDENTIALS=!file{service-account#.key}
+	`
+	tfs := &testFS{returnVal: ioutil.NopCloser(bytes.NewBufferString(envFile))}
+
+	env, err := parseFile(tfs, "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, env, &EnvVars{
+		Plain: map[string]string{
+			"PLAIN": "plaintext",
+		},
+		Secrets: map[string]string{
+			"SECRET":      "keep it secret",
+			"TLS_KEY":     "tls-key",
+			"CREDENTIALS": "service-account#.key",
+		},
+		Files: map[string]bool{
+			"TLS_KEY":     true,
+			"CREDENTIALS": true,
+		},
+	})
+}
+
 func TestParseFileScannerError(t *testing.T) {
 	tfs := &testFS{returnVal: &badReadCloser{}}
 
@@ -322,3 +356,110 @@ func TestParseEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMap(t *testing.T) {
+	env := ParseMap(map[string]string{
+		"one":   "!{a}",
+		"two":   "b",
+		"three": "!file{c}",
+	})
+
+	assert.DeepEqual(t, env, &EnvVars{
+		Plain: map[string]string{
+			"two": "b",
+		},
+		Secrets: map[string]string{
+			"one":   "a",
+			"three": "c",
+		},
+		Files: map[string]bool{
+			"three": true,
+		},
+	})
+}
+
+func TestMerge(t *testing.T) {
+	env := ParseMap(map[string]string{
+		"plain":       "a",
+		"secret":      "!{b}",
+		"file":        "!file{c}",
+		"to_plain":    "!file{d}",
+		"to_secret":   "e",
+		"file_secret": "!file{f}",
+	})
+
+	env.Merge(ParseMap(map[string]string{
+		"plain":       "aa",
+		"to_plain":    "dd",
+		"to_secret":   "!{ee}",
+		"file_secret": "!{ff}",
+		"new_file":    "!file{g}",
+	}))
+
+	assert.DeepEqual(t, env, &EnvVars{
+		Plain: map[string]string{
+			"plain":    "aa",
+			"to_plain": "dd",
+		},
+		Secrets: map[string]string{
+			"secret":      "b",
+			"file":        "c",
+			"to_secret":   "ee",
+			"file_secret": "ff",
+			"new_file":    "g",
+		},
+		Files: map[string]bool{
+			"file":     true,
+			"new_file": true,
+		},
+	})
+}
+
+func TestLint(t *testing.T) {
+	envFile := `# database
+DB_HOST=localhost
+DB_PASSWORD=!{db-password}
+TLS_KEY=!file{tls-key}
+BAD_VALUE
+=no key
+
+DB_HOST=127.0.0.1
+EMPTY=!{}
+JWT_KEY="-----BEGIN PUBLIC KEY-----
+MIGbMBAGByqGSM49AgEGBSuBBAAjA4GGAAQAC6vH7IGAp8pdUt92yiDGKt9mAwN3
+-----END PUBLIC KEY-----"
+EMPTY_FILE=!file{}
+CERT="-----BEGIN CERTIFICATE-----
+MIGbMBAGByqGSM49AgEGBSuBBAAjA4GGAAQAC6vH7IGAp8pdUt92yiDGKt9mAwN3
+`
+
+	res, err := Lint(bytes.NewBufferString(envFile))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, res.Entries, []Entry{
+		{Key: "DB_HOST", Line: 2, Value: "localhost"},
+		{Key: "DB_PASSWORD", Line: 3, Value: "db-password", Secret: true},
+		{Key: "TLS_KEY", Line: 4, Value: "tls-key", Secret: true, File: true},
+		{Key: "DB_HOST", Line: 8, Value: "127.0.0.1"},
+		{
+			Key:  "JWT_KEY",
+			Line: 10,
+			Value: "-----BEGIN PUBLIC KEY-----\n" +
+				"MIGbMBAGByqGSM49AgEGBSuBBAAjA4GGAAQAC6vH7IGAp8pdUt92yiDGKt9mAwN3\n" +
+				"-----END PUBLIC KEY-----",
+		},
+	})
+	assert.DeepEqual(t, res.Issues, []Issue{
+		{Line: 5, Rule: RuleMalformedLine, Message: "malformed line, expected KEY=value"},
+		{Line: 6, Rule: RuleMalformedLine, Message: "malformed line, expected KEY=value"},
+		{Line: 8, Key: "DB_HOST", Rule: RuleDuplicateKey, Message: "duplicate key DB_HOST, first defined on line 2"},
+		{Line: 9, Rule: RuleEmptySecret, Message: "secret reference is empty"},
+		{Line: 13, Rule: RuleEmptySecret, Message: "secret reference is empty"},
+		{Line: 14, Key: "CERT", Rule: RuleUnterminatedValue, Message: `multiline value of CERT is never terminated with "`},
+	})
+}
+
+func TestLintScannerError(t *testing.T) {
+	res, err := Lint(&badReadCloser{})
+	assert.Assert(t, res == nil)
+	assert.ErrorContains(t, err, "error parsing file")
+}
@@ -0,0 +1,118 @@
+package envparser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Lint rules reported by Lint.
+const (
+	RuleMalformedLine     = "malformed-line"
+	RuleEmptySecret       = "empty-secret"
+	RuleDuplicateKey      = "duplicate-key"
+	RuleUnterminatedValue = "unterminated-value"
+)
+
+// Issue is a problem found in a .env file.
+type Issue struct {
+	// Line is the 1-based line number of the problem, or 0 if it applies to the whole file.
+	Line    int
+	Key     string
+	Rule    string
+	Message string
+}
+
+// Entry is a variable defined in a .env file.
+type Entry struct {
+	Key  string
+	Line int
+	// Value is the plain text value, or the secret reference when Secret is true.
+	Value  string
+	Secret bool
+	File   bool
+}
+
+// LintResult contains the variables defined in a .env file and the problems found in it.
+type LintResult struct {
+	Entries []Entry
+	Issues  []Issue
+}
+
+// Lint parses .env formatted key/value pairs from r like Parse, but instead of stopping at the
+// first invalid line it reports every problem found along with its line number. Only read
+// errors are returned as an error.
+func Lint(r io.Reader) (*LintResult, error) {
+	var (
+		res       LintResult
+		lp        lineParser
+		lineNum   int
+		startLine int
+		defined   = make(map[string]int)
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNum++
+		multiline := lp.multiline
+
+		e, err := lp.parse(scanner.Text())
+		if !multiline && lp.multiline {
+			startLine = lineNum
+		}
+
+		// the line's content is not included in messages as it may contain a secret
+		var fe *formatError
+		switch {
+		case errors.As(err, &fe) && fe.emptySecret:
+			res.Issues = append(res.Issues, Issue{
+				Line: lineNum, Rule: RuleEmptySecret, Message: "secret reference is empty",
+			})
+			continue
+		case err != nil:
+			res.Issues = append(res.Issues, Issue{
+				Line: lineNum, Rule: RuleMalformedLine, Message: "malformed line, expected KEY=value",
+			})
+			continue
+		case e == nil:
+			continue
+		}
+
+		line := lineNum
+		if e.multiline {
+			line = startLine
+		}
+
+		if first, ok := defined[e.key]; ok {
+			res.Issues = append(res.Issues, Issue{
+				Line: line, Key: e.key, Rule: RuleDuplicateKey,
+				Message: fmt.Sprintf("duplicate key %s, first defined on line %d", e.key, first),
+			})
+		} else {
+			defined[e.key] = line
+		}
+
+		en := Entry{Key: e.key, Line: line, Value: e.value}
+		switch {
+		case e.multiline:
+		case secretRe.MatchString(e.value):
+			en.Secret, en.Value = true, secretRe.ReplaceAllString(e.value, "$secretval")
+		case fileSecretRe.MatchString(e.value):
+			en.Secret, en.File, en.Value = true, true, fileSecretRe.ReplaceAllString(e.value, "$secretval")
+		}
+		res.Entries = append(res.Entries, en)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error parsing file: %s", err)
+	}
+
+	if lp.multiline {
+		res.Issues = append(res.Issues, Issue{
+			Line: startLine, Key: lp.key, Rule: RuleUnterminatedValue,
+			Message: fmt.Sprintf("multiline value of %s is never terminated with \"", lp.key),
+		})
+	}
+
+	return &res, nil
+}
@@ -0,0 +1,140 @@
+package sops
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	ageKeyEnv     = "SOPS_AGE_KEY"
+	ageKeyFileEnv = "SOPS_AGE_KEY_FILE"
+	gpgExecEnv    = "SOPS_GPG_EXEC"
+	defaultGPG    = "gpg"
+	dataKeySize   = 32
+)
+
+// Keys holds the locally available keys used to decrypt the data key of a SOPS file.
+type Keys struct {
+	AgeIdentities []age.Identity
+	// PGPDecrypt decrypts an armored PGP message. When nil, PGP encrypted data keys are skipped.
+	PGPDecrypt func(enc string) ([]byte, error)
+}
+
+// LocalKeys returns the keys available locally, found the same way sops finds them: age
+// identities are read from SOPS_AGE_KEY, SOPS_AGE_KEY_FILE and the sops/age/keys.txt file in
+// the user's config directory, and PGP messages are decrypted with gpg (or SOPS_GPG_EXEC).
+func LocalKeys() (*Keys, error) {
+	k := &Keys{PGPDecrypt: gpgDecrypt}
+
+	if v := os.Getenv(ageKeyEnv); v != "" {
+		ids, err := age.ParseIdentities(strings.NewReader(v))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing identities from %s: %w", ageKeyEnv, err)
+		}
+		k.AgeIdentities = append(k.AgeIdentities, ids...)
+	}
+
+	var paths []string
+	if v := os.Getenv(ageKeyFileEnv); v != "" {
+		paths = append(paths, v)
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "sops", "age", "keys.txt"))
+	}
+
+	for i, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) && i == len(paths)-1 {
+			// the default key file is optional
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading age key file: %w", err)
+		}
+
+		ids, err := age.ParseIdentities(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing age key file %s: %w", p, err)
+		}
+		k.AgeIdentities = append(k.AgeIdentities, ids...)
+	}
+
+	return k, nil
+}
+
+func gpgDecrypt(enc string) ([]byte, error) {
+	bin := os.Getenv(gpgExecEnv)
+	if bin == "" {
+		bin = defaultGPG
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(bin, "--no-default-recipient", "--batch", "--decrypt") //nolint:gosec
+	cmd.Stdin = strings.NewReader(enc)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", bin, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// dataKey decrypts the data key using the first key that succeeds.
+func (k *Keys) dataKey(md *metadata) ([]byte, error) {
+	var errs []string
+
+	if len(md.age) > 0 && len(k.AgeIdentities) > 0 {
+		for _, e := range md.age {
+			key, err := k.decryptAge(e.enc)
+			if err == nil {
+				return key, nil
+			}
+			errs = append(errs, fmt.Sprintf("age %s: %s", e.recipient, err))
+		}
+	}
+
+	if k.PGPDecrypt != nil {
+		for _, e := range md.pgp {
+			key, err := k.PGPDecrypt(e.enc)
+			if err == nil && len(key) != dataKeySize {
+				err = fmt.Errorf("invalid data key size")
+			}
+			if err == nil {
+				return key, nil
+			}
+			errs = append(errs, fmt.Sprintf("pgp %s: %s", e.recipient, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("failed to decrypt data key: no matching age or pgp keys available")
+	}
+
+	return nil, fmt.Errorf("failed to decrypt data key: %s", strings.Join(errs, "; "))
+}
+
+func (k *Keys) decryptAge(enc string) ([]byte, error) {
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(enc)), k.AgeIdentities...)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("invalid data key size")
+	}
+
+	return key, nil
+}
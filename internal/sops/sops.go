@@ -0,0 +1,369 @@
+// Package sops contains functions for decrypting files encrypted with SOPS
+// (https://github.com/getsops/sops) using locally available age or PGP keys.
+package sops
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is the format of a SOPS encrypted file.
+type Format int
+
+// Supported SOPS file formats.
+const (
+	FormatDotenv Format = iota
+	FormatJSON
+	FormatYAML
+)
+
+const (
+	encRegex      = `^ENC\[AES256_GCM,data:(.*),iv:(.*),tag:(.*),type:(.*)\]$`
+	typeString    = "str"
+	typeInt       = "int"
+	typeFloat     = "float"
+	typeBool      = "bool"
+	typeBytes     = "bytes"
+	typeComment   = "comment"
+	pathSeparator = ":"
+)
+
+var encRe = regexp.MustCompile(encRegex)
+
+// macOnlyEncryptedInit is written to the MAC hash first when the MAC only covers encrypted
+// values. It is sha256("sops"), the same sequence used by sops.
+var macOnlyEncryptedInit = []byte{
+	0x8a, 0x3f, 0xd2, 0xad, 0x54, 0xce, 0x66, 0x52, 0x7b, 0x10, 0x34, 0xf3, 0xd1, 0x47, 0xbe, 0x0b,
+	0x0b, 0x97, 0x5b, 0x3b, 0xf4, 0x4f, 0x72, 0xc6, 0xfd, 0xad, 0xec, 0x81, 0x76, 0xf2, 0x7d, 0x69,
+}
+
+// FormatFromPath returns the format of a SOPS file based on its extension.
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".env":
+		return FormatDotenv, nil
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	default:
+		return 0, fmt.Errorf("unsupported sops file extension %q", filepath.Ext(path))
+	}
+}
+
+// item is a key/value pair of an ordered mapping. Values are either []item for
+// mappings, []interface{} for sequences or scalar values.
+type item struct {
+	key   string
+	value interface{}
+}
+
+// metadata contains the parts of the sops metadata needed for decryption.
+type metadata struct {
+	age              []keyGroupEntry
+	pgp              []keyGroupEntry
+	lastModified     string
+	mac              string
+	macOnlyEncrypted bool
+}
+
+// keyGroupEntry is an encrypted copy of the data key.
+type keyGroupEntry struct {
+	recipient string
+	enc       string
+}
+
+// Decrypt decrypts the SOPS file data and returns its top level entries. Nested values
+// are returned JSON encoded. The MAC of the file is verified and an error is returned if
+// it does not match the decrypted content.
+func (k *Keys) Decrypt(data []byte, format Format) (map[string]string, error) {
+	var (
+		tree []item
+		md   *metadata
+		err  error
+	)
+	switch format {
+	case FormatDotenv:
+		tree, md, err = parseDotenv(data)
+	case FormatJSON:
+		tree, md, err = parseJSON(data)
+	case FormatYAML:
+		tree, md, err = parseYAML(data)
+	default:
+		err = fmt.Errorf("unsupported format %d", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if md.mac == "" || md.lastModified == "" {
+		return nil, fmt.Errorf("file is missing sops metadata")
+	}
+
+	dataKey, err := k.dataKey(md)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decrypter{key: dataKey, macOnlyEncrypted: md.macOnlyEncrypted, hash: sha512.New()}
+	if d.macOnlyEncrypted {
+		_, _ = d.hash.Write(macOnlyEncryptedInit)
+	}
+	decrypted, err := d.mapping(tree, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.verifyMAC(md); err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]string, len(decrypted))
+	for _, it := range decrypted {
+		v, err := toEnvValue(it.value)
+		if err != nil {
+			return nil, fmt.Errorf("error converting value of %s: %w", it.key, err)
+		}
+		entries[it.key] = v
+	}
+
+	return entries, nil
+}
+
+type decrypter struct {
+	key              []byte
+	macOnlyEncrypted bool
+	hash             hash.Hash
+}
+
+func (d *decrypter) mapping(in []item, path []string) ([]item, error) {
+	out := make([]item, 0, len(in))
+	for _, it := range in {
+		v, err := d.value(it.value, append(path[:len(path):len(path)], it.key))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item{key: it.key, value: v})
+	}
+
+	return out, nil
+}
+
+func (d *decrypter) value(in interface{}, path []string) (interface{}, error) {
+	switch v := in.(type) {
+	case []item:
+		return d.mapping(v, path)
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		// sequence items share the path of their parent
+		for _, e := range v {
+			dv, err := d.value(e, path)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, dv)
+		}
+		return out, nil
+	case string:
+		if encRe.MatchString(v) {
+			plain, typed, err := decryptValue(v, d.key, strings.Join(path, pathSeparator)+pathSeparator)
+			if err != nil {
+				return nil, fmt.Errorf("error decrypting %s: %w", strings.Join(path, "."), err)
+			}
+			_, _ = d.hash.Write(plain)
+			return typed, nil
+		}
+	}
+
+	if !d.macOnlyEncrypted {
+		b, err := toBytes(in)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", strings.Join(path, "."), err)
+		}
+		_, _ = d.hash.Write(b)
+	}
+
+	return in, nil
+}
+
+func (d *decrypter) verifyMAC(md *metadata) error {
+	lastModified, err := time.Parse(time.RFC3339, md.lastModified)
+	if err != nil {
+		return fmt.Errorf("invalid lastmodified %q: %w", md.lastModified, err)
+	}
+
+	mac, _, err := decryptValue(md.mac, d.key, lastModified.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("error decrypting mac: %w", err)
+	}
+
+	if computed := fmt.Sprintf("%X", d.hash.Sum(nil)); computed != string(mac) {
+		return fmt.Errorf("mac mismatch: file has been tampered with or is corrupt")
+	}
+
+	return nil
+}
+
+// decryptValue decrypts a single ENC[...] value. It returns the plaintext bytes as well as the
+// plaintext converted to its original type.
+func decryptValue(value string, key []byte, additionalData string) ([]byte, interface{}, error) {
+	m := encRe.FindStringSubmatch(value)
+	if m == nil {
+		return nil, nil, fmt.Errorf("invalid encrypted value")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(m[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid data: %w", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(m[2])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid iv: %w", err)
+	}
+	tag, err := base64.StdEncoding.DecodeString(m[3])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid tag: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plain, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+
+	switch m[4] {
+	case typeString, typeComment:
+		return plain, string(plain), nil
+	case typeBytes:
+		return plain, plain, nil
+	case typeInt:
+		i, err := strconv.Atoi(string(plain))
+		if err != nil {
+			return nil, nil, err
+		}
+		return plain, i, nil
+	case typeFloat:
+		f, err := strconv.ParseFloat(string(plain), 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		return plain, f, nil
+	case typeBool:
+		b, err := strconv.ParseBool(strings.ToLower(string(plain)))
+		if err != nil {
+			return nil, nil, err
+		}
+		return plain, b, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown value type %q", m[4])
+	}
+}
+
+// toBytes returns the representation of a plaintext value used to compute the MAC.
+func toBytes(v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case string:
+		return []byte(t), nil
+	case []byte:
+		return t, nil
+	case int:
+		return []byte(strconv.Itoa(t)), nil
+	case float64:
+		return []byte(strconv.FormatFloat(t, 'f', -1, 64)), nil
+	case bool:
+		if t {
+			return []byte("True"), nil
+		}
+		return []byte("False"), nil
+	case nil:
+		return []byte{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// toEnvValue converts a decrypted value into an env var value.
+func toEnvValue(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case []byte:
+		return string(t), nil
+	case int:
+		return strconv.Itoa(t), nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case nil:
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writeJSON encodes v as JSON preserving the order of mappings.
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	switch t := v.(type) {
+	case []item:
+		buf.WriteByte('{')
+		for i, it := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			k, err := json.Marshal(it.key)
+			if err != nil {
+				return err
+			}
+			buf.Write(k)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, it.value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case []byte:
+		return writeJSON(buf, string(t))
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package sops
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"gotest.tools/v3/assert"
+)
+
+// The files in testdata were encrypted with sops 3.9.0 using the age key in testdata/keys.txt.
+
+func testKeys(t *testing.T) *Keys {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "keys.txt"))
+	assert.NilError(t, err)
+
+	ids, err := age.ParseIdentities(bytes.NewReader(b))
+	assert.NilError(t, err)
+
+	return &Keys{AgeIdentities: ids}
+}
+
+func readTestFile(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	assert.NilError(t, err)
+	return b
+}
+
+func TestDecrypt(t *testing.T) {
+	tt := []struct {
+		name     string
+		file     string
+		expected map[string]string
+	}{
+		{
+			name: "dotenv",
+			file: "secrets.env",
+			expected: map[string]string{
+				"DB_PASSWORD": "hunter2",
+				"PORT":        "5432",
+				"TLS_KEY":     "line1\nline2",
+			},
+		},
+		{
+			name: "json",
+			file: "secrets.json",
+			expected: map[string]string{
+				"DB_PASSWORD":        "hunter2",
+				"PORT":               "5432",
+				"RATIO":              "1.5",
+				"DEBUG":              "true",
+				"DATABASE":           `{"user":"admin","hosts":["a","b"]}`,
+				"PUBLIC_unencrypted": "visible",
+			},
+		},
+		{
+			name: "yaml",
+			file: "secrets.yaml",
+			expected: map[string]string{
+				"DB_PASSWORD":        "hunter2",
+				"PORT":               "5432",
+				"RATIO":              "1.5",
+				"DEBUG":              "true",
+				"DATABASE":           `{"user":"admin","hosts":["a","b"]}`,
+				"PUBLIC_unencrypted": "visible",
+			},
+		},
+		{
+			name: "mac only encrypted",
+			file: "mac_only_encrypted.yaml",
+			expected: map[string]string{
+				"DB_PASSWORD":        "hunter2",
+				"PORT":               "5432",
+				"RATIO":              "1.5",
+				"DEBUG":              "true",
+				"DATABASE":           `{"user":"admin","hosts":["a","b"]}`,
+				"PUBLIC_unencrypted": "visible",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			format, err := FormatFromPath(tc.file)
+			assert.NilError(t, err)
+
+			entries, err := testKeys(t).Decrypt(readTestFile(t, tc.file), format)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, entries, tc.expected)
+		})
+	}
+}
+
+func TestDecryptError(t *testing.T) {
+	otherID, err := age.GenerateX25519Identity()
+	assert.NilError(t, err)
+
+	tt := []struct {
+		name        string
+		file        string
+		modify      func(s string) string
+		keys        *Keys
+		expectedErr error
+	}{
+		{
+			name: "tampered unencrypted value",
+			file: "secrets.yaml",
+			modify: func(s string) string {
+				return strings.Replace(s, "PUBLIC_unencrypted: visible", "PUBLIC_unencrypted: tampered", 1)
+			},
+			expectedErr: errors.New("mac mismatch"),
+		},
+		{
+			name: "removed value",
+			file: "secrets.env",
+			modify: func(s string) string {
+				lines := strings.Split(s, "\n")
+				var out []string
+				for _, l := range lines {
+					if !strings.HasPrefix(l, "PORT=") {
+						out = append(out, l)
+					}
+				}
+				return strings.Join(out, "\n")
+			},
+			expectedErr: errors.New("mac mismatch"),
+		},
+		{
+			name: "moved encrypted value",
+			file: "secrets.json",
+			modify: func(s string) string {
+				return strings.Replace(s, `"DB_PASSWORD"`, `"DB_PASS"`, 1)
+			},
+			expectedErr: errors.New("error decrypting DB_PASS"),
+		},
+		{
+			name: "tampered lastmodified",
+			file: "secrets.env",
+			modify: func(s string) string {
+				return strings.Replace(s, "sops_lastmodified=2026", "sops_lastmodified=2027", 1)
+			},
+			expectedErr: errors.New("error decrypting mac"),
+		},
+		{
+			name:        "no matching key",
+			file:        "secrets.yaml",
+			keys:        &Keys{AgeIdentities: []age.Identity{otherID}},
+			expectedErr: errors.New("failed to decrypt data key"),
+		},
+		{
+			name:        "no keys",
+			file:        "secrets.yaml",
+			keys:        &Keys{},
+			expectedErr: errors.New("no matching age or pgp keys available"),
+		},
+		{
+			name: "missing metadata",
+			file: "secrets.json",
+			modify: func(s string) string {
+				return `{"DB_PASSWORD":"x"}`
+			},
+			expectedErr: errors.New("missing sops metadata"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			data := string(readTestFile(t, tc.file))
+			if tc.modify != nil {
+				data = tc.modify(data)
+			}
+			keys := tc.keys
+			if keys == nil {
+				keys = testKeys(t)
+			}
+
+			format, err := FormatFromPath(tc.file)
+			assert.NilError(t, err)
+
+			entries, err := keys.Decrypt([]byte(data), format)
+			assert.Assert(t, entries == nil)
+			assert.ErrorContains(t, err, tc.expectedErr.Error())
+		})
+	}
+}
+
+func TestDecryptPGP(t *testing.T) {
+	// use the age key to emulate gpg decrypting the data key
+	ageKeys := testKeys(t)
+	data := strings.Replace(string(readTestFile(t, "secrets.yaml")), "    pgp: []\n", "", 1)
+	data = strings.Replace(data, "    age:\n", "    pgp:\n", 1)
+	data = strings.Replace(data, "recipient: age", "fp: age", 1)
+
+	keys := &Keys{PGPDecrypt: ageKeys.decryptAge}
+	entries, err := keys.Decrypt([]byte(data), FormatYAML)
+	assert.NilError(t, err)
+	assert.Equal(t, entries["DB_PASSWORD"], "hunter2")
+
+	keys = &Keys{PGPDecrypt: func(enc string) ([]byte, error) {
+		return nil, errors.New("gpg: decryption failed: No secret key")
+	}}
+	_, err = keys.Decrypt([]byte(data), FormatYAML)
+	assert.ErrorContains(t, err, "No secret key")
+}
+
+func TestLocalKeys(t *testing.T) {
+	keyFile := filepath.Join("testdata", "keys.txt")
+	key := strings.TrimSpace(strings.Split(string(readTestFile(t, "keys.txt")), "\n")[1])
+
+	os.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+
+	os.Setenv(ageKeyEnv, key)
+	os.Setenv(ageKeyFileEnv, keyFile)
+	defer os.Unsetenv(ageKeyEnv)
+	defer os.Unsetenv(ageKeyFileEnv)
+
+	keys, err := LocalKeys()
+	assert.NilError(t, err)
+	assert.Equal(t, len(keys.AgeIdentities), 2)
+	assert.Assert(t, keys.PGPDecrypt != nil)
+
+	os.Setenv(ageKeyFileEnv, filepath.Join("testdata", "missing.txt"))
+	_, err = LocalKeys()
+	assert.ErrorContains(t, err, "error reading age key file")
+}
+
+func TestFormatFromPath(t *testing.T) {
+	for path, expected := range map[string]Format{
+		"a.env":         FormatDotenv,
+		"a.json":        FormatJSON,
+		"a.yaml":        FormatYAML,
+		"dir/a.YML":     FormatYAML,
+		"prod.sops.env": FormatDotenv,
+	} {
+		f, err := FormatFromPath(path)
+		assert.NilError(t, err)
+		assert.Equal(t, f, expected)
+	}
+
+	_, err := FormatFromPath("a.ini")
+	assert.ErrorContains(t, err, "unsupported sops file extension")
+}
@@ -0,0 +1,341 @@
+package sops
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	metadataKey       = "sops"
+	dotenvPrefix      = "sops_"
+	flatSeparator     = "__"
+	flatListPrefix    = "list_"
+	flatMapPrefix     = "map_"
+	dotenvCommentChar = "#"
+	dotenvSeparator   = "="
+)
+
+// parseDotenv parses a SOPS encrypted dotenv file. Metadata is stored flattened in
+// keys prefixed with sops_.
+func parseDotenv(data []byte) ([]item, *metadata, error) {
+	var tree []item
+	flat := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, dotenvCommentChar) {
+			continue
+		}
+
+		kv := strings.SplitN(line, dotenvSeparator, 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, nil, fmt.Errorf("invalid dotenv line %d", n)
+		}
+		k, v := kv[0], strings.ReplaceAll(kv[1], `\n`, "\n")
+
+		if strings.HasPrefix(k, dotenvPrefix) {
+			flat[strings.TrimPrefix(k, dotenvPrefix)] = v
+			continue
+		}
+		tree = append(tree, item{key: k, value: v})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading dotenv file: %w", err)
+	}
+
+	md, err := metadataFromMap(unflatten(flat))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tree, md, nil
+}
+
+// unflatten reverses the flattening sops applies to metadata in dotenv files,
+// e.g. age__list_0__map_enc.
+func unflatten(flat map[string]string) map[string]interface{} {
+	root := make(map[string]interface{})
+	for k, v := range flat {
+		segments := strings.Split(k, flatSeparator)
+		m := root
+		for i, s := range segments {
+			s = strings.TrimPrefix(s, flatMapPrefix)
+			if i == len(segments)-1 {
+				m[s] = v
+				break
+			}
+
+			next, ok := m[s].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				m[s] = next
+			}
+			m = next
+		}
+	}
+
+	return listify(root).(map[string]interface{})
+}
+
+// listify converts maps whose keys are all list_<n> into slices.
+func listify(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+
+	indexes := make([]int, 0, len(m))
+	for k, e := range m {
+		m[k] = listify(e)
+		if !strings.HasPrefix(k, flatListPrefix) {
+			continue
+		}
+		if i, err := strconv.Atoi(strings.TrimPrefix(k, flatListPrefix)); err == nil {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(m) == 0 || len(indexes) != len(m) {
+		return m
+	}
+
+	sort.Ints(indexes)
+	l := make([]interface{}, 0, len(indexes))
+	for _, i := range indexes {
+		l = append(l, m[flatListPrefix+strconv.Itoa(i)])
+	}
+	return l
+}
+
+// parseJSON parses a SOPS encrypted JSON file preserving the order of keys.
+func parseJSON(data []byte) ([]item, *metadata, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing json: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, fmt.Errorf("error parsing json: unexpected data after top level value")
+	}
+
+	root, ok := v.([]item)
+	if !ok {
+		return nil, nil, fmt.Errorf("error parsing json: top level value is not an object")
+	}
+
+	return splitMetadata(root)
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch d := t.(type) {
+	case json.Delim:
+		switch d {
+		case '{':
+			var items []item
+			for dec.More() {
+				kt, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item{key: kt.(string), value: v})
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return items, nil
+		case '[':
+			l := []interface{}{}
+			for dec.More() {
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				l = append(l, v)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return l, nil
+		}
+		return nil, fmt.Errorf("unexpected delimiter %s", d)
+	case json.Number:
+		if i, err := strconv.Atoi(d.String()); err == nil {
+			return i, nil
+		}
+		return d.Float64()
+	default:
+		return d, nil
+	}
+}
+
+// parseYAML parses a SOPS encrypted YAML file preserving the order of keys.
+func parseYAML(data []byte) ([]item, *metadata, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("error parsing yaml: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 {
+		return nil, nil, fmt.Errorf("error parsing yaml: expected a single document")
+	}
+
+	v, err := yamlValue(doc.Content[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing yaml: %w", err)
+	}
+
+	root, ok := v.([]item)
+	if !ok {
+		return nil, nil, fmt.Errorf("error parsing yaml: top level value is not a mapping")
+	}
+
+	return splitMetadata(root)
+}
+
+func yamlValue(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		items := make([]item, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v, err := yamlValue(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item{key: n.Content[i].Value, value: v})
+		}
+		return items, nil
+	case yaml.SequenceNode:
+		l := make([]interface{}, 0, len(n.Content))
+		for _, c := range n.Content {
+			v, err := yamlValue(c)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+	case yaml.ScalarNode:
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unsupported yaml node at line %d", n.Line)
+	}
+}
+
+// splitMetadata removes the sops metadata from the tree and parses it.
+func splitMetadata(root []item) ([]item, *metadata, error) {
+	tree := make([]item, 0, len(root))
+	var md *metadata
+	for _, it := range root {
+		if it.key != metadataKey {
+			tree = append(tree, it)
+			continue
+		}
+
+		m, ok := toGeneric(it.value).(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid sops metadata")
+		}
+
+		var err error
+		if md, err = metadataFromMap(m); err != nil {
+			return nil, nil, err
+		}
+	}
+	if md == nil {
+		return nil, nil, fmt.Errorf("file is missing sops metadata")
+	}
+
+	return tree, md, nil
+}
+
+func toGeneric(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []item:
+		m := make(map[string]interface{}, len(t))
+		for _, it := range t {
+			m[it.key] = toGeneric(it.value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, 0, len(t))
+		for _, e := range t {
+			l = append(l, toGeneric(e))
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+func metadataFromMap(m map[string]interface{}) (*metadata, error) {
+	md := &metadata{}
+	md.lastModified, _ = m["lastmodified"].(string)
+	md.mac, _ = m["mac"].(string)
+
+	switch v := m["mac_only_encrypted"].(type) {
+	case bool:
+		md.macOnlyEncrypted = v
+	case string:
+		md.macOnlyEncrypted = v == "true"
+	}
+
+	var err error
+	if md.age, err = keyGroupEntries(m["age"], "recipient"); err != nil {
+		return nil, fmt.Errorf("invalid age metadata: %w", err)
+	}
+	if md.pgp, err = keyGroupEntries(m["pgp"], "fp"); err != nil {
+		return nil, fmt.Errorf("invalid pgp metadata: %w", err)
+	}
+
+	return md, nil
+}
+
+func keyGroupEntries(v interface{}, recipientKey string) ([]keyGroupEntry, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	l, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list")
+	}
+
+	entries := make([]keyGroupEntry, 0, len(l))
+	for _, e := range l {
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a list of mappings")
+		}
+
+		var entry keyGroupEntry
+		entry.recipient, _ = m[recipientKey].(string)
+		entry.enc, _ = m["enc"].(string)
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -2,8 +2,10 @@ package serum
 
 import (
 	"fmt"
+	"io/ioutil"
 
 	"github.com/wingocard/serum/internal/envparser"
+	"github.com/wingocard/serum/internal/sops"
 )
 
 // A Loader loads env variables from a source into an Injector and prepares
@@ -22,7 +24,7 @@ func (f LoaderFunc) Load(ij *Injector) error {
 }
 
 // FromFile returns a loader that will parse a .env file for key/value pairs and
-// assign them to an Injector.
+// assign them to an Injector. The file can be watched for changes using Injector.WatchFiles.
 func FromFile(path string) Loader {
 	return LoaderFunc(func(ij *Injector) error {
 		envVars, err := envparser.ParseFile(path)
@@ -31,10 +33,47 @@ func FromFile(path string) Loader {
 		}
 
 		ij.envVars = envVars
+		ij.sourceFiles = []string{path}
 		return nil
 	})
 }
 
+// FromFiles returns a loader that will parse the .env files at paths in order and assign their
+// merged key/value pairs to an Injector. A key defined in more than one file takes its value
+// from the last file, e.g. a .env.local file can override the defaults in a .env file.
+// The files can be watched for changes using Injector.WatchFiles.
+func FromFiles(paths ...string) Loader {
+	return LoaderFunc(func(ij *Injector) error {
+		envVars, err := parseFiles(paths)
+		if err != nil {
+			return err
+		}
+
+		ij.envVars = envVars
+		ij.sourceFiles = paths
+		return nil
+	})
+}
+
+// parseFiles parses the .env files at paths in order and merges their key/value pairs.
+func parseFiles(paths []string) (*envparser.EnvVars, error) {
+	envVars := &envparser.EnvVars{
+		Plain:   make(map[string]string),
+		Secrets: make(map[string]string),
+	}
+
+	for _, path := range paths {
+		layer, err := envparser.ParseFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading env vars from file: %w", err)
+		}
+
+		envVars.Merge(layer)
+	}
+
+	return envVars, nil
+}
+
 // FromEnv returns a loader that will parse the current process' environment for
 // the specified keys and assigns them to an Injector.
 func FromEnv(keys []string) Loader {
@@ -48,3 +87,44 @@ func FromEnv(keys []string) Loader {
 		return nil
 	})
 }
+
+// FromMap returns a loader that will assign the key/value pairs in vars to an Injector.
+// Values in the form !{...} are treated as secrets.
+func FromMap(vars map[string]string) Loader {
+	return LoaderFunc(func(ij *Injector) error {
+		ij.envVars = envparser.ParseMap(vars)
+		return nil
+	})
+}
+
+// FromSOPSFile returns a loader that will decrypt a SOPS encrypted dotenv, JSON or YAML
+// file and assign its top level entries to an Injector. The file is decrypted with the
+// age or PGP keys available locally, found the same way the sops binary finds them.
+// The MAC of the file is verified and a tampered file will cause the loader to fail.
+// Decrypted values in the form !{...} are treated as secrets.
+func FromSOPSFile(path string) Loader {
+	return LoaderFunc(func(ij *Injector) error {
+		format, err := sops.FormatFromPath(path)
+		if err != nil {
+			return fmt.Errorf("error loading env vars from sops file: %w", err)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error loading env vars from sops file: %w", err)
+		}
+
+		keys, err := sops.LocalKeys()
+		if err != nil {
+			return fmt.Errorf("error loading env vars from sops file: %w", err)
+		}
+
+		entries, err := keys.Decrypt(data, format)
+		if err != nil {
+			return fmt.Errorf("error loading env vars from sops file %s: %w", path, err)
+		}
+
+		ij.envVars = envparser.ParseMap(entries)
+		return nil
+	})
+}
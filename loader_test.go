@@ -0,0 +1,112 @@
+package serum
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wingocard/serum/internal/envparser"
+	"gotest.tools/v3/assert"
+)
+
+func TestFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	assert.NilError(t, ioutil.WriteFile(base, []byte("HOST=localhost\nPORT=5432\nDB_PASSWORD=!{db-password}\n"), 0600))
+	assert.NilError(t, ioutil.WriteFile(local, []byte("PORT=5433\nDB_PASSWORD=hunter2\nTLS_KEY=!file{tls-key}\n"), 0600))
+
+	ij := &Injector{}
+	err := FromFiles(base, local).Load(ij)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ij.envVars, &envparser.EnvVars{
+		Plain: map[string]string{
+			"HOST":        "localhost",
+			"PORT":        "5433",
+			"DB_PASSWORD": "hunter2",
+		},
+		Secrets: map[string]string{
+			"TLS_KEY": "tls-key",
+		},
+		Files: map[string]bool{
+			"TLS_KEY": true,
+		},
+	})
+
+	err = FromFiles(base, filepath.Join(dir, "missing.env")).Load(&Injector{})
+	assert.ErrorContains(t, err, "error loading env vars from file")
+}
+
+func TestFromSOPSFile(t *testing.T) {
+	os.Setenv("SOPS_AGE_KEY_FILE", filepath.Join("internal", "sops", "testdata", "keys.txt"))
+	defer os.Unsetenv("SOPS_AGE_KEY_FILE")
+
+	ij := &Injector{}
+	err := FromSOPSFile(filepath.Join("internal", "sops", "testdata", "secrets.env")).Load(ij)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ij.envVars, &envparser.EnvVars{
+		Plain: map[string]string{
+			"DB_PASSWORD": "hunter2",
+			"PORT":        "5432",
+			"TLS_KEY":     "line1\nline2",
+		},
+		Secrets: map[string]string{},
+	})
+}
+
+func TestFromSOPSFileError(t *testing.T) {
+	os.Setenv("SOPS_AGE_KEY_FILE", filepath.Join("internal", "sops", "testdata", "keys.txt"))
+	defer os.Unsetenv("SOPS_AGE_KEY_FILE")
+
+	b, err := ioutil.ReadFile(filepath.Join("internal", "sops", "testdata", "secrets.env"))
+	assert.NilError(t, err)
+	tampered := filepath.Join(t.TempDir(), "tampered.env")
+	err = ioutil.WriteFile(tampered, []byte(strings.Replace(string(b), "PORT=", "# PORT=", 1)), 0600)
+	assert.NilError(t, err)
+
+	tt := []struct {
+		name        string
+		path        string
+		expectedErr string
+	}{
+		{
+			name:        "tampered file",
+			path:        tampered,
+			expectedErr: "mac mismatch",
+		},
+		{
+			name:        "missing file",
+			path:        filepath.Join(t.TempDir(), "missing.env"),
+			expectedErr: "no such file",
+		},
+		{
+			name:        "unsupported format",
+			path:        "secrets.ini",
+			expectedErr: "unsupported sops file extension",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ij, err := NewInjector(FromSOPSFile(tc.path))
+			assert.Assert(t, ij == nil)
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	ij := &Injector{}
+	err := FromMap(map[string]string{
+		"LOG_LEVEL":   "debug",
+		"DB_PASSWORD": "!{k8s://prod/db#DB_PASSWORD}",
+	}).Load(ij)
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ij.envVars, &envparser.EnvVars{
+		Plain:   map[string]string{"LOG_LEVEL": "debug"},
+		Secrets: map[string]string{"DB_PASSWORD": "k8s://prod/db#DB_PASSWORD"},
+	})
+}
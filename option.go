@@ -2,6 +2,7 @@ package serum
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/wingocard/serum/secretprovider"
 )
@@ -24,3 +25,20 @@ func WithSecretProviderFunc(f func() (secretprovider.SecretProvider, error)) Opt
 		return nil
 	}
 }
+
+// WithSecretFileDir sets the directory the secrets declared using !file{} are written to.
+// It defaults to the OS' temp directory.
+func WithSecretFileDir(dir string) Option {
+	return func(ij *Injector) error {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("error setting secret file directory: %w", err)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("error setting secret file directory: %s is not a directory", dir)
+		}
+
+		ij.secretFileDir = dir
+		return nil
+	}
+}
@@ -2,6 +2,8 @@ package serum
 
 import (
 	"errors"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/wingocard/serum/secretprovider"
@@ -47,3 +49,46 @@ func TestWithSecretProvider(t *testing.T) {
 		})
 	}
 }
+
+func TestWithSecretFileDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	assert.NilError(t, ioutil.WriteFile(file, nil, 0600))
+
+	tt := []struct {
+		name        string
+		dir         string
+		expectedErr error
+	}{
+		{
+			name: "directory",
+			dir:  dir,
+		},
+		{
+			name:        "missing directory",
+			dir:         filepath.Join(dir, "missing"),
+			expectedErr: errors.New("error setting secret file directory"),
+		},
+		{
+			name:        "not a directory",
+			dir:         file,
+			expectedErr: errors.New("is not a directory"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ij := &Injector{}
+
+			err := WithSecretFileDir(tc.dir)(ij)
+			if tc.expectedErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, ij.secretFileDir, tc.dir)
+				return
+			}
+
+			assert.ErrorContains(t, err, tc.expectedErr.Error())
+			assert.Equal(t, ij.secretFileDir, "")
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package serum
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	fieldSeparator    = "#."
+	modifierSeparator = "|"
+)
+
+// modifier transforms a decrypted secret value.
+type modifier func(v string) (string, error)
+
+// modifiers contains the modifiers that can be appended to a secret reference, e.g. !{ref|trim}.
+var modifiers = map[string]modifier{
+	"base64decode": base64Decode,
+	"trim":         trim,
+	"json":         compactJSON,
+}
+
+// reference is a secret reference as written in a .env file. The secret is passed to the
+// SecretProvider, the field and modifiers are applied to the decrypted value, in that order.
+//
+//	!{<secret>[#.<field>[.<field>...]][|<modifier>...]}
+type reference struct {
+	secret    string
+	field     []string
+	modifiers []string
+}
+
+// parseReference splits a secret reference into the secret, the JSON field path and the modifiers.
+// Only known modifiers are split off the end of the reference and the field path is split on the
+// last #., so references that contain | or # for the SecretProvider are left untouched.
+func parseReference(ref string) (*reference, error) {
+	r := &reference{secret: ref}
+
+	for {
+		i := strings.LastIndex(r.secret, modifierSeparator)
+		if i < 0 {
+			break
+		}
+		if _, ok := modifiers[r.secret[i+1:]]; !ok {
+			break
+		}
+		r.modifiers = append([]string{r.secret[i+1:]}, r.modifiers...)
+		r.secret = r.secret[:i]
+	}
+
+	if i := strings.LastIndex(r.secret, fieldSeparator); i >= 0 {
+		path := r.secret[i+len(fieldSeparator):]
+		r.field = strings.Split(path, ".")
+		for _, f := range r.field {
+			if f == "" {
+				return nil, fmt.Errorf("invalid field %q in secret reference %s", path, ref)
+			}
+		}
+		r.secret = r.secret[:i]
+	}
+
+	if r.secret == "" && ref != "" {
+		return nil, fmt.Errorf("invalid secret reference %s", ref)
+	}
+
+	return r, nil
+}
+
+// apply extracts the field from the decrypted value and applies the modifiers to it.
+func (r *reference) apply(v string) (string, error) {
+	if len(r.field) > 0 {
+		var err error
+		if v, err = extractField(v, r.field); err != nil {
+			return "", err
+		}
+	}
+
+	for _, name := range r.modifiers {
+		var err error
+		if v, err = modifiers[name](v); err != nil {
+			return "", fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	return v, nil
+}
+
+// extractField returns the value at path in the JSON document v. Strings are returned
+// as is, any other value is returned as JSON.
+func extractField(v string, path []string) (string, error) {
+	d := json.NewDecoder(strings.NewReader(v))
+	d.UseNumber()
+
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		return "", fmt.Errorf("value is not a JSON document")
+	}
+
+	for i, f := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[f]
+			if !ok {
+				return "", fmt.Errorf("field %q not found", strings.Join(path[:i+1], "."))
+			}
+			doc = child
+		case []interface{}:
+			idx, err := strconv.Atoi(f)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return "", fmt.Errorf("field %q not found", strings.Join(path[:i+1], "."))
+			}
+			doc = node[idx]
+		default:
+			return "", fmt.Errorf("field %q not found", strings.Join(path[:i+1], "."))
+		}
+	}
+
+	switch node := doc.(type) {
+	case string:
+		return node, nil
+	case nil:
+		return "", nil
+	default:
+		b, err := json.Marshal(node)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+}
+
+// base64Decode decodes standard or URL safe base64, with or without padding.
+func base64Decode(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		if b, err := enc.DecodeString(v); err == nil {
+			return string(b), nil
+		}
+	}
+
+	return "", fmt.Errorf("value is not valid base64")
+}
+
+func trim(v string) (string, error) {
+	return strings.TrimSpace(v), nil
+}
+
+// compactJSON validates that the value is a JSON document and removes its insignificant
+// whitespace, so e.g. a multiline service account key fits on a single line.
+func compactJSON(v string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(v)); err != nil {
+		return "", fmt.Errorf("value is not a JSON document")
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,243 @@
+package serum
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseReference(t *testing.T) {
+	tt := []struct {
+		name        string
+		ref         string
+		expected    *reference
+		expectedErr error
+	}{
+		{
+			name:     "plain reference",
+			ref:      "projects/p/secrets/db/versions/latest",
+			expected: &reference{secret: "projects/p/secrets/db/versions/latest"},
+		},
+		{
+			name:     "field",
+			ref:      "db-credentials#.password",
+			expected: &reference{secret: "db-credentials", field: []string{"password"}},
+		},
+		{
+			name:     "nested field",
+			ref:      "db-credentials#.primary.hosts.0",
+			expected: &reference{secret: "db-credentials", field: []string{"primary", "hosts", "0"}},
+		},
+		{
+			name:     "modifiers",
+			ref:      "tls-key|base64decode|trim",
+			expected: &reference{secret: "tls-key", modifiers: []string{"base64decode", "trim"}},
+		},
+		{
+			name: "field and modifiers",
+			ref:  "service-account#.private_key|trim",
+			expected: &reference{
+				secret:    "service-account",
+				field:     []string{"private_key"},
+				modifiers: []string{"trim"},
+			},
+		},
+		{
+			name:     "provider field is kept",
+			ref:      "secret/data/app#password",
+			expected: &reference{secret: "secret/data/app#password"},
+		},
+		{
+			name:     "provider field with json field",
+			ref:      "secret/data/app#config#.port",
+			expected: &reference{secret: "secret/data/app#config", field: []string{"port"}},
+		},
+		{
+			name:     "unknown modifier is kept",
+			ref:      "plugin:a|b",
+			expected: &reference{secret: "plugin:a|b"},
+		},
+		{
+			name:        "empty field",
+			ref:         "db-credentials#.",
+			expectedErr: errors.New(`invalid field "" in secret reference db-credentials#.`),
+		},
+		{
+			name:        "empty nested field",
+			ref:         "db-credentials#.primary..password",
+			expectedErr: errors.New(`invalid field "primary..password"`),
+		},
+		{
+			name:        "only modifiers",
+			ref:         "|trim",
+			expectedErr: errors.New("invalid secret reference |trim"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := parseReference(tc.ref)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, r.secret, tc.expected.secret)
+			assert.DeepEqual(t, r.field, tc.expected.field)
+			assert.DeepEqual(t, r.modifiers, tc.expected.modifiers)
+		})
+	}
+}
+
+func TestReferenceApply(t *testing.T) {
+	doc := `{
+		"user": "admin",
+		"password": "  hunter2\n",
+		"port": 5432,
+		"tls": true,
+		"cert": null,
+		"hosts": ["db-0", "db-1"],
+		"primary": {"host": "db-0", "port": 5432}
+	}`
+
+	tt := []struct {
+		name        string
+		ref         string
+		value       string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "no field or modifiers",
+			ref:      "db",
+			value:    "superSecret",
+			expected: "superSecret",
+		},
+		{
+			name:     "string field",
+			ref:      "db#.user",
+			value:    doc,
+			expected: "admin",
+		},
+		{
+			name:     "number field",
+			ref:      "db#.port",
+			value:    doc,
+			expected: "5432",
+		},
+		{
+			name:     "bool field",
+			ref:      "db#.tls",
+			value:    doc,
+			expected: "true",
+		},
+		{
+			name:     "null field",
+			ref:      "db#.cert",
+			value:    doc,
+			expected: "",
+		},
+		{
+			name:     "array index",
+			ref:      "db#.hosts.1",
+			value:    doc,
+			expected: "db-1",
+		},
+		{
+			name:     "object field",
+			ref:      "db#.primary",
+			value:    doc,
+			expected: `{"host":"db-0","port":5432}`,
+		},
+		{
+			name:     "nested field",
+			ref:      "db#.primary.host",
+			value:    doc,
+			expected: "db-0",
+		},
+		{
+			name:     "field and trim",
+			ref:      "db#.password|trim",
+			value:    doc,
+			expected: "hunter2",
+		},
+		{
+			name:     "base64decode",
+			ref:      "key|base64decode",
+			value:    "c3VwZXJTZWNyZXQ=\n",
+			expected: "superSecret",
+		},
+		{
+			name:     "base64decode url encoding without padding",
+			ref:      "key|base64decode",
+			value:    "Pz8_",
+			expected: "???",
+		},
+		{
+			name:     "base64decode json",
+			ref:      "key|base64decode|json",
+			value:    "eyJ1c2VyIjoiYWRtaW4ifQ==",
+			expected: `{"user":"admin"}`,
+		},
+		{
+			name:     "json",
+			ref:      "sa|json",
+			value:    "{\n  \"type\": \"service_account\",\n  \"project_id\": \"p\"\n}\n",
+			expected: `{"type":"service_account","project_id":"p"}`,
+		},
+		{
+			name:        "field of non JSON value",
+			ref:         "db#.user",
+			value:       "superSecret",
+			expectedErr: errors.New("value is not a JSON document"),
+		},
+		{
+			name:        "missing field",
+			ref:         "db#.primary.user",
+			value:       doc,
+			expectedErr: errors.New(`field "primary.user" not found`),
+		},
+		{
+			name:        "invalid array index",
+			ref:         "db#.hosts.2",
+			value:       doc,
+			expectedErr: errors.New(`field "hosts.2" not found`),
+		},
+		{
+			name:        "field of scalar",
+			ref:         "db#.user.name",
+			value:       doc,
+			expectedErr: errors.New(`field "user.name" not found`),
+		},
+		{
+			name:        "invalid base64",
+			ref:         "key|base64decode",
+			value:       "superSecret!",
+			expectedErr: errors.New("base64decode: value is not valid base64"),
+		},
+		{
+			name:        "invalid json",
+			ref:         "sa|json",
+			value:       "superSecret",
+			expectedErr: errors.New("json: value is not a JSON document"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := parseReference(tc.ref)
+			assert.NilError(t, err)
+
+			v, err := r.apply(tc.value)
+			if tc.expectedErr != nil {
+				assert.Error(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, v, tc.expected)
+		})
+	}
+}
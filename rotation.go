@@ -0,0 +1,205 @@
+package serum
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/wingocard/serum/internal/envparser"
+	"github.com/wingocard/serum/secretprovider"
+)
+
+// RotationFunc is called by Injector.Watch with the old and new decrypted value of a secret
+// env var whose value changed.
+type RotationFunc func(key, old, new string)
+
+// WatchOption represents a function that can be passed into Injector.Watch to modify
+// how rotated secrets are detected.
+type WatchOption func(w *watcher)
+
+// WatchInterval resolves the secrets again every d.
+func WatchInterval(d time.Duration) WatchOption {
+	return func(w *watcher) {
+		w.interval = d
+	}
+}
+
+// WatchReinject sets the env vars of rotated secrets to their new values before the
+// RotationFuncs are called. Secrets declared using !file{} have their file overwritten.
+func WatchReinject() WatchOption {
+	return func(w *watcher) {
+		w.reinject = true
+	}
+}
+
+// WatchErrors calls f with the errors that occur while watching, e.g. a SecretProvider that
+// is temporarily unavailable or a watched .env file that fails to parse. Watching continues
+// after an error. Errors are ignored by default.
+func WatchErrors(f func(err error)) WatchOption {
+	return func(w *watcher) {
+		w.onError = f
+	}
+}
+
+type watcher struct {
+	interval time.Duration
+	reinject bool
+	debounce time.Duration
+	onError  func(err error)
+	// ready is called once WatchFiles watches the files, it is used by tests
+	ready func()
+}
+
+func newWatcher(options []WatchOption) *watcher {
+	w := &watcher{
+		debounce: defaultDebounce,
+		onError:  func(error) {},
+		ready:    func() {},
+	}
+	for _, option := range options {
+		option(w)
+	}
+
+	return w
+}
+
+// OnRotate registers f to be called by Watch when the decrypted value of the secret env var key
+// changes. More than one RotationFunc can be registered for a key, they are called in order.
+func (ij *Injector) OnRotate(key string, f RotationFunc) {
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+
+	if ij.rotationFuncs == nil {
+		ij.rotationFuncs = make(map[string][]RotationFunc)
+	}
+	ij.rotationFuncs[key] = append(ij.rotationFuncs[key], f)
+}
+
+// Watch resolves the secrets again on the interval set using WatchInterval and whenever the
+// SecretProvider, if it implements secretprovider.Notifier, notifies that secrets changed. The
+// new values are compared with the values decrypted by the previous Inject or check, and the
+// RotationFuncs registered for the keys that changed are called with the old and new values.
+// Watch blocks until ctx is done and returns ctx's error.
+func (ij *Injector) Watch(ctx context.Context, options ...WatchOption) error {
+	w := newWatcher(options)
+	if ij.secretProvider == nil {
+		return fmt.Errorf("serum: error watching secrets: the SecretProvider is nil")
+	}
+	notifier, ok := ij.secretProvider.(secretprovider.Notifier)
+	if w.interval <= 0 && !ok {
+		return fmt.Errorf("serum: error watching secrets: no interval set and the SecretProvider does not send notifications")
+	}
+
+	var tick <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var changed chan string
+	if ok {
+		changed = make(chan string)
+		go func() {
+			if err := notifier.Notify(ctx, changed); err != nil && ctx.Err() == nil {
+				w.onError(fmt.Errorf("serum: error receiving secret notifications: %w", err))
+			}
+		}()
+	}
+
+	// secrets that were not injected yet are decrypted first, so only later changes are reported
+	ij.mu.Lock()
+	initialized := ij.decrypted != nil
+	ij.mu.Unlock()
+	if !initialized {
+		if err := ij.checkRotation(ctx, w); err != nil {
+			w.onError(err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+		case <-changed:
+		}
+
+		if err := ij.checkRotation(ctx, w); err != nil {
+			w.onError(err)
+		}
+	}
+}
+
+// checkRotation decrypts the secrets again and calls the RotationFuncs of the keys whose value changed.
+func (ij *Injector) checkRotation(ctx context.Context, w *watcher) error {
+	env := ij.loaded()
+	decrypted, err := ij.decryptSecrets(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	ij.mu.Lock()
+	if ij.envVars != env {
+		// the env vars were reloaded meanwhile, their secrets are checked on the next interval
+		ij.mu.Unlock()
+		return nil
+	}
+	old := ij.decrypted
+	ij.decrypted = decrypted
+	if old == nil {
+		ij.mu.Unlock()
+		return nil
+	}
+
+	var rotated []string
+	for k, v := range decrypted {
+		if o, ok := old[k]; ok && o != v {
+			rotated = append(rotated, k)
+		}
+	}
+	sort.Strings(rotated)
+
+	var reinjectErr error
+	if w.reinject {
+		reinjectErr = ij.reinject(env, rotated, decrypted)
+	}
+	if ij.config != nil && len(rotated) > 0 {
+		ij.config.replace(merge(env.Plain, decrypted))
+	}
+	funcs := make(map[string][]RotationFunc, len(rotated))
+	for _, k := range rotated {
+		funcs[k] = ij.rotationFuncs[k]
+	}
+	ij.mu.Unlock()
+
+	for _, k := range rotated {
+		for _, f := range funcs[k] {
+			f(k, old[k], decrypted[k])
+		}
+	}
+
+	return reinjectErr
+}
+
+// reinject sets the env vars of the rotated keys to their new value, it must be called with ij.mu held.
+func (ij *Injector) reinject(env *envparser.EnvVars, rotated []string, decrypted map[string]string) error {
+	for _, k := range rotated {
+		v := decrypted[k]
+		if env.Files[k] {
+			path, err := ij.writeSecretFile(k, v)
+			if err != nil {
+				return fmt.Errorf("serum: error writing secret file for env var %s: %s", k, err)
+			}
+			v = path
+		}
+
+		if err := os.Setenv(k, v); err != nil {
+			return fmt.Errorf("serum: error setting env var %s: %s", k, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package serum
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wingocard/serum/internal/envparser"
+	"gotest.tools/v3/assert"
+)
+
+// rotatingSecretProvider returns secrets that can be changed concurrently and sends the
+// changes to Notify when notify is set.
+type rotatingSecretProvider struct {
+	mu      sync.Mutex
+	secrets map[string]string
+	err     error
+	notify  chan string
+}
+
+// newRotatingSecretProvider returns a rotatingSecretProvider for the secrets of newRotationInjector.
+func newRotatingSecretProvider() *rotatingSecretProvider {
+	return &rotatingSecretProvider{
+		secrets: map[string]string{"db-password": "hunter2", "api-key": "key1", "tls-key": "pem1"},
+	}
+}
+
+func (rs *rotatingSecretProvider) Decrypt(ctx context.Context, secret string) (string, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.err != nil {
+		return "", rs.err
+	}
+	return rs.secrets[secret], nil
+}
+
+func (rs *rotatingSecretProvider) Close() error {
+	return nil
+}
+
+func (rs *rotatingSecretProvider) rotate(secret, value string) {
+	rs.mu.Lock()
+	rs.secrets[secret] = value
+	rs.mu.Unlock()
+}
+
+func (rs *rotatingSecretProvider) setErr(err error) {
+	rs.mu.Lock()
+	rs.err = err
+	rs.mu.Unlock()
+}
+
+// notifyingSecretProvider is a rotatingSecretProvider that implements secretprovider.Notifier.
+type notifyingSecretProvider struct {
+	*rotatingSecretProvider
+}
+
+func (ns *notifyingSecretProvider) Notify(ctx context.Context, changed chan<- string) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case s := <-ns.notify:
+			select {
+			case changed <- s:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+type rotation struct {
+	key, old, new string
+}
+
+func newRotationInjector(t *testing.T, sp *rotatingSecretProvider, notify bool) *Injector {
+	t.Helper()
+
+	ij := &Injector{
+		envVars: &envparser.EnvVars{
+			Plain:   map[string]string{"DB_HOST": "localhost"},
+			Secrets: map[string]string{"DB_PASSWORD": "db-password", "API_KEY": "api-key", "TLS_KEY": "tls-key"},
+			Files:   map[string]bool{"TLS_KEY": true},
+		},
+		secretProvider: sp,
+		secretFileDir:  t.TempDir(),
+	}
+	if notify {
+		ij.secretProvider = &notifyingSecretProvider{sp}
+	}
+	t.Cleanup(func() {
+		assert.NilError(t, ij.Close())
+		assert.NilError(t, cleanupEnv(ij.envVars))
+	})
+
+	return ij
+}
+
+// watch runs Watch until the test ends and returns the rotations it reports.
+func watch(t *testing.T, ij *Injector, options ...WatchOption) <-chan rotation {
+	t.Helper()
+
+	rotations := make(chan rotation, 10)
+	for _, k := range []string{"DB_PASSWORD", "API_KEY", "TLS_KEY"} {
+		ij.OnRotate(k, func(key, old, new string) {
+			rotations <- rotation{key: key, old: old, new: new}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- ij.Watch(ctx, options...)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.Equal(t, <-done, context.Canceled)
+	})
+
+	return rotations
+}
+
+func nextRotation(t *testing.T, rotations <-chan rotation) rotation {
+	t.Helper()
+
+	select {
+	case r := <-rotations:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a rotation")
+		return rotation{}
+	}
+}
+
+func TestWatchInterval(t *testing.T) {
+	sp := newRotatingSecretProvider()
+	ij := newRotationInjector(t, sp, false)
+	assert.NilError(t, ij.Inject(context.Background()))
+
+	rotations := watch(t, ij, WatchInterval(10*time.Millisecond))
+
+	sp.rotate("db-password", "hunter3")
+	assert.Equal(t, nextRotation(t, rotations), rotation{key: "DB_PASSWORD", old: "hunter2", new: "hunter3"})
+	// the environment is not updated without WatchReinject
+	assert.Equal(t, os.Getenv("DB_PASSWORD"), "hunter2")
+
+	sp.rotate("api-key", "key2")
+	assert.Equal(t, nextRotation(t, rotations), rotation{key: "API_KEY", old: "key1", new: "key2"})
+}
+
+func TestWatchReinject(t *testing.T) {
+	sp := newRotatingSecretProvider()
+	ij := newRotationInjector(t, sp, false)
+	assert.NilError(t, ij.Inject(context.Background()))
+	path := os.Getenv("TLS_KEY")
+
+	rotations := watch(t, ij, WatchInterval(10*time.Millisecond), WatchReinject())
+
+	sp.rotate("db-password", "hunter3")
+	assert.Equal(t, nextRotation(t, rotations), rotation{key: "DB_PASSWORD", old: "hunter2", new: "hunter3"})
+	assert.Equal(t, os.Getenv("DB_PASSWORD"), "hunter3")
+
+	sp.rotate("tls-key", "pem2")
+	assert.Equal(t, nextRotation(t, rotations), rotation{key: "TLS_KEY", old: "pem1", new: "pem2"})
+	assert.Equal(t, os.Getenv("TLS_KEY"), path)
+	data, err := ioutil.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "pem2")
+}
+
+func TestWatchNotifications(t *testing.T) {
+	sp := &rotatingSecretProvider{
+		secrets: map[string]string{"db-password": "hunter2", "api-key": "key1", "tls-key": "pem1"},
+		notify:  make(chan string),
+	}
+	ij := newRotationInjector(t, sp, true)
+
+	// without Inject, the first values are decrypted by Watch
+	rotations := watch(t, ij)
+
+	// the second notification is received once Watch is done with the first one, after it
+	// decrypted the first values
+	sp.notify <- "api-key"
+	sp.notify <- "api-key"
+	sp.rotate("db-password", "hunter3")
+	sp.notify <- "db-password"
+	assert.Equal(t, nextRotation(t, rotations), rotation{key: "DB_PASSWORD", old: "hunter2", new: "hunter3"})
+	assert.Equal(t, len(rotations), 0)
+}
+
+func TestWatchErrors(t *testing.T) {
+	sp := newRotatingSecretProvider()
+	ij := newRotationInjector(t, sp, false)
+	assert.NilError(t, ij.Inject(context.Background()))
+
+	errs := make(chan error, 10)
+	sp.setErr(errors.New("unavailable"))
+	rotations := watch(t, ij, WatchInterval(10*time.Millisecond), WatchErrors(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}))
+
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, "unavailable")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an error")
+	}
+
+	// watching continues after errors
+	sp.rotate("db-password", "hunter3")
+	sp.setErr(nil)
+	assert.Equal(t, nextRotation(t, rotations), rotation{key: "DB_PASSWORD", old: "hunter2", new: "hunter3"})
+}
+
+func TestWatchError(t *testing.T) {
+	ij := &Injector{envVars: &envparser.EnvVars{}}
+	err := ij.Watch(context.Background(), WatchInterval(time.Second))
+	assert.Error(t, err, "serum: error watching secrets: the SecretProvider is nil")
+
+	ij.secretProvider = &testSecretProvider{}
+	err = ij.Watch(context.Background())
+	assert.Error(t, err,
+		"serum: error watching secrets: no interval set and the SecretProvider does not send notifications")
+}
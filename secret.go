@@ -0,0 +1,92 @@
+package serum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret is a decrypted secret value that is redacted when it is printed using fmt, marshalled to
+// JSON or text, or logged using log/slog, so it doesn't end up in logs or panics by accident. The
+// value is only returned by Reveal.
+//
+// Secret implements encoding.TextUnmarshaler, so third-party decoders, e.g. encoding/json, can
+// decode values into Secret fields. Marshalling is one way: the [REDACTED] placeholder is rejected
+// when it is unmarshalled, so re-encoding a struct can't silently replace a secret with it.
+type Secret struct {
+	value string
+}
+
+// NewSecret returns a Secret containing value.
+func NewSecret(value string) Secret {
+	return Secret{value: value}
+}
+
+// Reveal returns the plain text value of the secret.
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+// String implements fmt.Stringer and returns [REDACTED].
+func (s Secret) String() string {
+	return redacted
+}
+
+// GoString implements fmt.GoStringer and returns [REDACTED].
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// Format implements fmt.Formatter and writes [REDACTED] for every verb, %q quotes it.
+func (s Secret) Format(f fmt.State, verb rune) {
+	if verb == 'q' {
+		fmt.Fprint(f, strconv.Quote(redacted))
+		return
+	}
+	fmt.Fprint(f, redacted)
+}
+
+// MarshalJSON implements json.Marshaler and returns "[REDACTED]".
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// MarshalText implements encoding.TextMarshaler and returns [REDACTED].
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler and sets the value of the secret to text.
+// It returns an error if text is the [REDACTED] placeholder written by MarshalText.
+func (s *Secret) UnmarshalText(text []byte) error {
+	if string(text) == redacted {
+		return fmt.Errorf("serum: can not unmarshal the %s placeholder into a Secret", redacted)
+	}
+
+	s.value = string(text)
+	return nil
+}
+
+// ResolveSecrets decrypts the loaded secrets, like Resolve, and returns them as Secrets keyed by
+// env var. Plain text variables are not included. Secrets declared using !file{} are resolved to their
+// decrypted value.
+func (ij *Injector) ResolveSecrets(ctx context.Context) (map[string]Secret, error) {
+	env := ij.loaded()
+	if len(env.Secrets) > 0 && ij.secretProvider == nil {
+		return nil, fmt.Errorf("serum: error resolving secrets: secrets were loaded but the SecretProvider is nil")
+	}
+
+	decrypted, err := ij.decryptSecrets(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string]Secret, len(decrypted))
+	for k, v := range decrypted {
+		secrets[k] = NewSecret(v)
+	}
+	return secrets, nil
+}
@@ -0,0 +1,11 @@
+//go:build go1.21
+// +build go1.21
+
+package serum
+
+import "log/slog"
+
+// LogValue implements slog.LogValuer and returns [REDACTED].
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
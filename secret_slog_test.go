@@ -0,0 +1,24 @@
+//go:build go1.21
+// +build go1.21
+
+package serum
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSecretLogValue(t *testing.T) {
+	s := NewSecret("hunter2")
+	assert.Equal(t, s.LogValue().String(), "[REDACTED]")
+
+	var b bytes.Buffer
+	slog.New(slog.NewTextHandler(&b, nil)).Info("connecting", "password", s)
+	slog.New(slog.NewJSONHandler(&b, nil)).Info("connecting", "password", s, slog.Group("db", "password", s))
+	assert.Assert(t, !strings.Contains(b.String(), "hunter2"), b.String())
+	assert.Equal(t, strings.Count(b.String(), "[REDACTED]"), 3)
+}
@@ -0,0 +1,108 @@
+package serum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/wingocard/serum/internal/envparser"
+	"gotest.tools/v3/assert"
+)
+
+func TestSecret(t *testing.T) {
+	s := NewSecret("hunter2")
+	assert.Equal(t, s.Reveal(), "hunter2")
+	assert.Equal(t, s.String(), "[REDACTED]")
+	assert.Equal(t, s.GoString(), "[REDACTED]")
+
+	tt := []struct {
+		format   string
+		expected string
+	}{
+		{format: "%s", expected: "[REDACTED]"},
+		{format: "%v", expected: "[REDACTED]"},
+		{format: "%+v", expected: "[REDACTED]"},
+		{format: "%#v", expected: "[REDACTED]"},
+		{format: "%q", expected: `"[REDACTED]"`},
+		{format: "%d", expected: "[REDACTED]"},
+		{format: "%x", expected: "[REDACTED]"},
+		{format: "%10s", expected: "[REDACTED]"},
+	}
+	for _, tc := range tt {
+		assert.Equal(t, fmt.Sprintf(tc.format, s), tc.expected, tc.format)
+	}
+
+	// secrets nested in other values are redacted too
+	nested := struct {
+		Password Secret
+		Ptr      *Secret
+	}{Password: s, Ptr: &s}
+	assert.Equal(t, fmt.Sprintf("%+v", nested.Password), "[REDACTED]")
+	assert.Equal(t, fmt.Sprintf("%v", []Secret{s}), "[[REDACTED]]")
+	assert.Equal(t, fmt.Sprintf("%v", map[string]Secret{"k": s}), "map[k:[REDACTED]]")
+	assert.Equal(t, fmt.Sprintf("%v", nested.Ptr), "[REDACTED]")
+	assert.Assert(t, !strings.Contains(fmt.Sprintf("%+v %#v", nested, nested), "hunter2"))
+}
+
+func TestSecretMarshal(t *testing.T) {
+	s := NewSecret("hunter2")
+
+	data, err := json.Marshal(struct {
+		Password Secret            `json:"password"`
+		Secrets  map[string]Secret `json:"secrets"`
+	}{Password: s, Secrets: map[string]Secret{"k": s}})
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), `{"password":"[REDACTED]","secrets":{"k":"[REDACTED]"}}`)
+
+	text, err := s.MarshalText()
+	assert.NilError(t, err)
+	assert.Equal(t, string(text), "[REDACTED]")
+}
+
+func TestSecretUnmarshal(t *testing.T) {
+	var v struct {
+		Password Secret `json:"password"`
+	}
+	assert.NilError(t, json.Unmarshal([]byte(`{"password":"hunter2"}`), &v))
+	assert.Equal(t, v.Password.Reveal(), "hunter2")
+
+	var s Secret
+	assert.NilError(t, s.UnmarshalText([]byte("hunter3")))
+	assert.Equal(t, s.Reveal(), "hunter3")
+
+	// marshalling is one way, the placeholder is not decoded back as the value
+	data, err := json.Marshal(v)
+	assert.NilError(t, err)
+	err = json.Unmarshal(data, &v)
+	assert.ErrorContains(t, err, "serum: can not unmarshal the [REDACTED] placeholder into a Secret")
+	assert.Equal(t, v.Password.Reveal(), "hunter2")
+
+	text, err := s.MarshalText()
+	assert.NilError(t, err)
+	assert.ErrorContains(t, s.UnmarshalText(text), "placeholder")
+	assert.Equal(t, s.Reveal(), "hunter3")
+}
+
+func TestResolveSecrets(t *testing.T) {
+	ij := &Injector{
+		envVars: &envparser.EnvVars{
+			Plain:   map[string]string{"DB_HOST": "localhost"},
+			Secrets: map[string]string{"DB_PASSWORD": "db-password", "TLS_KEY": "tls-key"},
+			Files:   map[string]bool{"TLS_KEY": true},
+		},
+		secretProvider: &testSecretProvider{returnSecret: map[string]string{"db-password": "hunter2", "tls-key": "pem"}},
+	}
+
+	secrets, err := ij.ResolveSecrets(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, len(secrets), 2)
+	assert.Equal(t, secrets["DB_PASSWORD"].Reveal(), "hunter2")
+	assert.Equal(t, secrets["TLS_KEY"].Reveal(), "pem")
+	assert.Equal(t, fmt.Sprint(secrets), "map[DB_PASSWORD:[REDACTED] TLS_KEY:[REDACTED]]")
+
+	ij.secretProvider = nil
+	_, err = ij.ResolveSecrets(context.Background())
+	assert.Error(t, err, "serum: error resolving secrets: secrets were loaded but the SecretProvider is nil")
+}
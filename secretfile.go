@@ -0,0 +1,86 @@
+package serum
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const secretFilePattern = "serum-"
+
+// writeSecretFile writes the decrypted value of the secret k to a file that is only readable by the
+// current user and returns its path. The same file is overwritten when Inject is called again.
+func (ij *Injector) writeSecretFile(k, v string) (string, error) {
+	if path, ok := ij.secretFiles[k]; ok {
+		if err := ioutil.WriteFile(path, []byte(v), 0600); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+
+	// temp files are created with 0600 permissions
+	f, err := ioutil.TempFile(ij.secretFileDir, secretFilePattern)
+	if err != nil {
+		return "", err
+	}
+
+	if ij.secretFiles == nil {
+		ij.secretFiles = make(map[string]string)
+	}
+	ij.secretFiles[k] = f.Name()
+
+	if _, err := f.WriteString(v); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// removeSecretFiles overwrites the secret files written by Inject and removes them.
+// It returns the first error encountered.
+func (ij *Injector) removeSecretFiles() error {
+	var firstErr error
+	for k, path := range ij.secretFiles {
+		if err := shred(path); err != nil && !os.IsNotExist(err) {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("serum: error removing secret file %s: %s", path, err)
+			}
+			continue
+		}
+		delete(ij.secretFiles, k)
+	}
+
+	return firstErr
+}
+
+// shred overwrites the contents of the file at path with zeros before removing it.
+func shred(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err := f.Write(make([]byte, fi.Size())); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
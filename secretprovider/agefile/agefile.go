@@ -0,0 +1,268 @@
+// Package agefile contains the secretprovider implementation for secrets encrypted
+// locally with age. It does not depend on any cloud service and works fully offline.
+package agefile
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/wingocard/serum/internal/envparser"
+)
+
+const (
+	// DefaultIdentityEnv is the env variable that is read for age identities
+	// when no identity option is passed to New.
+	DefaultIdentityEnv = "SERUM_AGE_IDENTITY"
+
+	inlinePrefix = "age:"
+	keySeparator = "#"
+)
+
+// Option represents a function that can be passed into New to modify
+// the behavior of the AgeFile provider.
+type Option func(a *AgeFile) error
+
+// WithIdentityFile adds the age identities found in the key file at path,
+// e.g. a file generated by age-keygen.
+func WithIdentityFile(path string) Option {
+	return func(a *AgeFile) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open identity file: %w", err)
+		}
+		defer f.Close()
+
+		ids, err := age.ParseIdentities(f)
+		if err != nil {
+			return fmt.Errorf("failed to parse identity file %s: %w", path, err)
+		}
+
+		a.identities = append(a.identities, ids...)
+		return nil
+	}
+}
+
+// WithIdentityEnv adds the age identities found in the env variable name.
+func WithIdentityEnv(name string) Option {
+	return func(a *AgeFile) error {
+		v, ok := os.LookupEnv(name)
+		if !ok || strings.TrimSpace(v) == "" {
+			return fmt.Errorf("env variable %q not found", name)
+		}
+
+		ids, err := age.ParseIdentities(strings.NewReader(v))
+		if err != nil {
+			return fmt.Errorf("failed to parse identities from env variable %q: %w", name, err)
+		}
+
+		a.identities = append(a.identities, ids...)
+		return nil
+	}
+}
+
+// WithPassphrase adds a passphrase identity that decrypts values encrypted
+// to an age scrypt recipient.
+func WithPassphrase(passphrase string) Option {
+	return func(a *AgeFile) error {
+		id, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return fmt.Errorf("invalid passphrase: %w", err)
+		}
+
+		a.identities = append(a.identities, id)
+		return nil
+	}
+}
+
+// WithBaseDir sets the directory that relative store paths are resolved against.
+// It defaults to the current working directory.
+func WithBaseDir(dir string) Option {
+	return func(a *AgeFile) error {
+		a.baseDir = dir
+		return nil
+	}
+}
+
+// AgeFile is a secret provider that decrypts secrets encrypted with age.
+//
+// Secrets can either be inline ciphertexts, age:<base64 encoded age file>, or references
+// into a local encrypted store, <path>#<key>. A store is an age encrypted file that contains
+// either a JSON object or .env formatted key/value pairs. Stores are decrypted once and
+// kept in memory until Close is called.
+type AgeFile struct {
+	identities []age.Identity
+	baseDir    string
+
+	mu     sync.Mutex
+	stores map[string]map[string]string
+}
+
+// New returns an initialized AgeFile using the identities from the provided options.
+// If no identity is provided, identities are read from the env variable DefaultIdentityEnv.
+func New(options ...Option) (*AgeFile, error) {
+	a := &AgeFile{
+		stores: make(map[string]map[string]string),
+	}
+	for _, option := range options {
+		if err := option(a); err != nil {
+			return nil, fmt.Errorf("agefile: %w", err)
+		}
+	}
+
+	if len(a.identities) == 0 {
+		if err := WithIdentityEnv(DefaultIdentityEnv)(a); err != nil {
+			return nil, fmt.Errorf("agefile: no identities provided: %w", err)
+		}
+	}
+
+	return a, nil
+}
+
+// Decrypt will decrypt the inline ciphertext or store reference and return the plain text string.
+func (a *AgeFile) Decrypt(ctx context.Context, secret string) (string, error) {
+	if strings.HasPrefix(secret, inlinePrefix) {
+		ct, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, inlinePrefix))
+		if err != nil {
+			return "", fmt.Errorf("agefile: invalid inline ciphertext: %w", err)
+		}
+
+		plain, err := a.decrypt(bytes.NewReader(ct))
+		if err != nil {
+			return "", fmt.Errorf("agefile: failed to decrypt inline ciphertext: %w", err)
+		}
+		return string(plain), nil
+	}
+
+	i := strings.LastIndex(secret, keySeparator)
+	if i <= 0 || i == len(secret)-1 {
+		return "", fmt.Errorf("agefile: invalid secret reference %q, expected %s<ciphertext> or <path>#<key>",
+			secret, inlinePrefix)
+	}
+	path, key := secret[:i], secret[i+1:]
+
+	store, err := a.store(path)
+	if err != nil {
+		return "", fmt.Errorf("agefile: %w", err)
+	}
+
+	v, ok := store[key]
+	if !ok {
+		return "", fmt.Errorf("agefile: key %q not found in store %s", key, path)
+	}
+
+	return v, nil
+}
+
+// Close drops any decrypted stores held in memory.
+func (a *AgeFile) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stores = make(map[string]map[string]string)
+	return nil
+}
+
+func (a *AgeFile) decrypt(r io.Reader) ([]byte, error) {
+	dr, err := age.Decrypt(r, a.identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(dr)
+}
+
+func (a *AgeFile) store(path string) (map[string]string, error) {
+	if !filepath.IsAbs(path) && a.baseDir != "" {
+		path = filepath.Join(a.baseDir, path)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if s, ok := a.stores[path]; ok {
+		return s, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+	defer f.Close()
+
+	plain, err := a.decrypt(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt store %s: %w", path, err)
+	}
+
+	s, err := parseStore(plain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse store %s: %w", path, err)
+	}
+
+	a.stores[path] = s
+	return s, nil
+}
+
+// parseStore parses the decrypted content of a store as a JSON object when it starts
+// with "{" and as .env formatted key/value pairs otherwise.
+func parseStore(plain []byte) (map[string]string, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(plain), []byte("{")) {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(plain, &raw); err != nil {
+			return nil, err
+		}
+
+		s := make(map[string]string, len(raw))
+		for k, v := range raw {
+			if str, ok := v.(string); ok {
+				s[k] = str
+				continue
+			}
+
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			s[k] = string(b)
+		}
+		return s, nil
+	}
+
+	envVars, err := envparser.Parse(bytes.NewReader(plain))
+	if err != nil {
+		return nil, err
+	}
+	if len(envVars.Secrets) > 0 {
+		return nil, fmt.Errorf("stores can not contain secret references")
+	}
+
+	return envVars.Plain, nil
+}
+
+// Encrypt encrypts plaintext to the recipients and returns an inline reference
+// that can be used as a secret in a .env file.
+func Encrypt(plaintext []byte, recipients ...age.Recipient) (string, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return "", fmt.Errorf("agefile: failed to encrypt: %w", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return "", fmt.Errorf("agefile: failed to encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("agefile: failed to encrypt: %w", err)
+	}
+
+	return inlinePrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,264 @@
+package agefile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"gotest.tools/v3/assert"
+)
+
+func newIdentity(t *testing.T) *age.X25519Identity {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("error generating identity: %s", err)
+	}
+
+	return id
+}
+
+func writeStore(t *testing.T, path, content string, recipient age.Recipient) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipient)
+	assert.NilError(t, err)
+	_, err = w.Write([]byte(content))
+	assert.NilError(t, err)
+	assert.NilError(t, w.Close())
+	assert.NilError(t, ioutil.WriteFile(path, buf.Bytes(), 0600))
+}
+
+func TestNew(t *testing.T) {
+	id := newIdentity(t)
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.txt")
+	assert.NilError(t, ioutil.WriteFile(keyFile, []byte("# created: today\n"+id.String()+"\n"), 0600))
+	badKeyFile := filepath.Join(dir, "bad.txt")
+	assert.NilError(t, ioutil.WriteFile(badKeyFile, []byte("not a key\n"), 0600))
+
+	tt := []struct {
+		name        string
+		env         map[string]string
+		options     []Option
+		expectedIDs int
+		expectedErr error
+	}{
+		{
+			name:        "identity file",
+			options:     []Option{WithIdentityFile(keyFile)},
+			expectedIDs: 1,
+		},
+		{
+			name:        "missing identity file",
+			options:     []Option{WithIdentityFile(filepath.Join(dir, "missing"))},
+			expectedErr: errors.New("failed to open identity file"),
+		},
+		{
+			name:        "bad identity file",
+			options:     []Option{WithIdentityFile(badKeyFile)},
+			expectedErr: errors.New("failed to parse identity file"),
+		},
+		{
+			name:        "identity env",
+			env:         map[string]string{"MY_AGE_KEY": id.String()},
+			options:     []Option{WithIdentityEnv("MY_AGE_KEY")},
+			expectedIDs: 1,
+		},
+		{
+			name:        "default identity env",
+			env:         map[string]string{DefaultIdentityEnv: id.String()},
+			expectedIDs: 1,
+		},
+		{
+			name:        "no identities",
+			expectedErr: errors.New("no identities provided"),
+		},
+		{
+			name:        "multiple identities",
+			options:     []Option{WithIdentityFile(keyFile), WithPassphrase("correct horse")},
+			expectedIDs: 2,
+		},
+		{
+			name:        "empty passphrase",
+			options:     []Option{WithPassphrase("")},
+			expectedErr: errors.New("invalid passphrase"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			a, err := New(tc.options...)
+			if tc.expectedErr != nil {
+				assert.Assert(t, a == nil)
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(a.identities), tc.expectedIDs)
+		})
+	}
+}
+
+func TestDecryptInline(t *testing.T) {
+	id := newIdentity(t)
+	other := newIdentity(t)
+
+	scrypt, err := age.NewScryptRecipient("correct horse")
+	assert.NilError(t, err)
+	scrypt.SetWorkFactor(10)
+
+	x25519Ref, err := Encrypt([]byte("superSecret"), id.Recipient())
+	assert.NilError(t, err)
+	scryptRef, err := Encrypt([]byte("passphrase secret"), scrypt)
+	assert.NilError(t, err)
+
+	tt := []struct {
+		name        string
+		options     []Option
+		secret      string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "x25519",
+			options:  []Option{func(a *AgeFile) error { a.identities = []age.Identity{other, id}; return nil }},
+			secret:   x25519Ref,
+			expected: "superSecret",
+		},
+		{
+			name:        "x25519 wrong identity",
+			options:     []Option{func(a *AgeFile) error { a.identities = []age.Identity{other}; return nil }},
+			secret:      x25519Ref,
+			expectedErr: errors.New("failed to decrypt inline ciphertext"),
+		},
+		{
+			name:     "passphrase",
+			options:  []Option{WithPassphrase("correct horse")},
+			secret:   scryptRef,
+			expected: "passphrase secret",
+		},
+		{
+			name:        "wrong passphrase",
+			options:     []Option{WithPassphrase("battery staple")},
+			secret:      scryptRef,
+			expectedErr: errors.New("failed to decrypt inline ciphertext"),
+		},
+		{
+			name:        "bad base64",
+			options:     []Option{WithPassphrase("correct horse")},
+			secret:      "age:!!!",
+			expectedErr: errors.New("invalid inline ciphertext"),
+		},
+		{
+			name:        "invalid reference",
+			options:     []Option{WithPassphrase("correct horse")},
+			secret:      "no-key-separator",
+			expectedErr: errors.New("invalid secret reference"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := New(tc.options...)
+			assert.NilError(t, err)
+
+			dec, err := a.Decrypt(context.Background(), tc.secret)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, dec, tc.expected)
+		})
+	}
+}
+
+func TestDecryptStore(t *testing.T) {
+	id := newIdentity(t)
+	dir := t.TempDir()
+	writeStore(t, filepath.Join(dir, "secrets.json.age"), `{"DB_PASSWORD":"hunter2","PORT":5432}`, id.Recipient())
+	writeStore(t, filepath.Join(dir, "secrets.env.age"), "# db\nDB_PASSWORD=env-hunter2\n", id.Recipient())
+	writeStore(t, filepath.Join(dir, "nested.env.age"), "DB_PASSWORD=!{other}\n", id.Recipient())
+
+	a := &AgeFile{
+		identities: []age.Identity{id},
+		baseDir:    dir,
+		stores:     make(map[string]map[string]string),
+	}
+
+	tt := []struct {
+		name        string
+		secret      string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "json store",
+			secret:   "secrets.json.age#DB_PASSWORD",
+			expected: "hunter2",
+		},
+		{
+			name:     "json store non string value",
+			secret:   "secrets.json.age#PORT",
+			expected: "5432",
+		},
+		{
+			name:     "env store",
+			secret:   "secrets.env.age#DB_PASSWORD",
+			expected: "env-hunter2",
+		},
+		{
+			name:     "absolute path",
+			secret:   filepath.Join(dir, "secrets.env.age") + "#DB_PASSWORD",
+			expected: "env-hunter2",
+		},
+		{
+			name:        "missing key",
+			secret:      "secrets.env.age#USER",
+			expectedErr: errors.New(`key "USER" not found`),
+		},
+		{
+			name:        "missing store",
+			secret:      "missing.age#USER",
+			expectedErr: errors.New("failed to open store"),
+		},
+		{
+			name:        "nested references",
+			secret:      "nested.env.age#DB_PASSWORD",
+			expectedErr: errors.New("stores can not contain secret references"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dec, err := a.Decrypt(context.Background(), tc.secret)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, dec, tc.expected)
+		})
+	}
+
+	// stores are cached until Close is called
+	assert.NilError(t, os.Remove(filepath.Join(dir, "secrets.env.age")))
+	_, err := a.Decrypt(context.Background(), "secrets.env.age#DB_PASSWORD")
+	assert.NilError(t, err)
+
+	assert.NilError(t, a.Close())
+	_, err = a.Decrypt(context.Background(), "secrets.env.age#DB_PASSWORD")
+	assert.ErrorContains(t, err, "failed to open store")
+}
@@ -0,0 +1,165 @@
+// Package azkeyvault contains the secretprovider implementation
+// for Azure Key Vault.
+package azkeyvault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultDNSSuffix = "vault.azure.net"
+	secretsPath      = "secrets"
+)
+
+var vaultNameRe = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// Option represents a function that can be passed into New to modify
+// the behavior of the AzKeyVault provider.
+type Option func(kv *AzKeyVault)
+
+// WithHTTPClient sets the http client used to communicate with Key Vault.
+// The client is owned by the caller and is left untouched by Close.
+func WithHTTPClient(c *http.Client) Option {
+	return func(kv *AzKeyVault) {
+		kv.httpClient = c
+	}
+}
+
+// WithDNSSuffix sets the DNS suffix of the vaults, e.g. vault.azure.cn for Azure China. It is
+// used to expand short vault/name references, full secret identifiers must use a vault host
+// ending in it and tokens are requested for the https://<suffix> resource. It defaults to
+// vault.azure.net. Sovereign clouds also need the authority host of their credential to be set,
+// see WithAuthorityHost.
+func WithDNSSuffix(suffix string) Option {
+	return func(kv *AzKeyVault) {
+		kv.dnsSuffix = strings.TrimPrefix(suffix, ".")
+	}
+}
+
+// AzKeyVault is a secret provider that communicates with Azure Key Vault
+// to decrypt secrets.
+type AzKeyVault struct {
+	kvClient   keyVaultClient
+	httpClient *http.Client
+	dnsSuffix  string
+}
+
+// New returns an initialized AzKeyVault that authenticates requests using cred.
+func New(cred Credential, options ...Option) (*AzKeyVault, error) {
+	if cred == nil {
+		return nil, fmt.Errorf("azkeyvault: credential is nil")
+	}
+
+	kv := &AzKeyVault{
+		dnsSuffix: defaultDNSSuffix,
+	}
+	for _, option := range options {
+		option(kv)
+	}
+
+	// without an injected client the provider uses its own transport so Close
+	// never drops connections shared with the rest of the process
+	ownsClient := kv.httpClient == nil
+	if ownsClient {
+		kv.httpClient = &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+	}
+
+	kv.kvClient = &restClient{
+		cred:       cred,
+		resource:   "https://" + kv.dnsSuffix,
+		httpClient: kv.httpClient,
+		ownsClient: ownsClient,
+	}
+	return kv, nil
+}
+
+// Decrypt will get the secret from Azure Key Vault and return the plain text string.
+// The secret can either be a full secret identifier,
+// https://<vault>.vault.azure.net/secrets/<name>[/<version>], or a short
+// <vault>/<name>[/<version>] reference. The latest version is used when no version is given.
+// Identifiers that don't use https or a vault host ending in the DNS suffix are rejected, so
+// tokens are never sent to other hosts.
+func (kv *AzKeyVault) Decrypt(ctx context.Context, secret string) (string, error) {
+	ref, err := parseSecretRef(secret, kv.dnsSuffix)
+	if err != nil {
+		return "", fmt.Errorf("azkeyvault: %w", err)
+	}
+
+	val, err := kv.kvClient.GetSecret(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("azkeyvault: failed to get secret %s: %w", ref.name, err)
+	}
+
+	return val, nil
+}
+
+// Close closes any idle connections to the Key Vault API held by the provider's
+// own http client. A client set with WithHTTPClient is not closed.
+func (kv *AzKeyVault) Close() error {
+	return kv.kvClient.Close()
+}
+
+// secretRef identifies a secret version in a vault.
+type secretRef struct {
+	vaultURL string
+	name     string
+	version  string
+}
+
+func (r *secretRef) url() string {
+	u := fmt.Sprintf("%s/%s/%s", r.vaultURL, secretsPath, url.PathEscape(r.name))
+	if r.version != "" {
+		u += "/" + url.PathEscape(r.version)
+	}
+	return u
+}
+
+func parseSecretRef(secret, dnsSuffix string) (*secretRef, error) {
+	if strings.Contains(secret, "://") {
+		u, err := url.Parse(secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret identifier %q: %w", secret, err)
+		}
+
+		if u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid secret identifier %q: scheme must be https", secret)
+		}
+		host := strings.ToLower(u.Host)
+		if vault := strings.TrimSuffix(host, "."+dnsSuffix); vault == host || !vaultNameRe.MatchString(vault) {
+			return nil, fmt.Errorf("invalid secret identifier %q: host must be a vault in %s", secret, dnsSuffix)
+		}
+
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] != secretsPath || parts[1] == "" {
+			return nil, fmt.Errorf("invalid secret identifier %q", secret)
+		}
+
+		ref := &secretRef{
+			vaultURL: "https://" + host,
+			name:     parts[1],
+		}
+		if len(parts) == 3 {
+			ref.version = parts[2]
+		}
+		return ref, nil
+	}
+
+	parts := strings.Split(secret, "/")
+	if len(parts) < 2 || len(parts) > 3 || !vaultNameRe.MatchString(parts[0]) || parts[1] == "" {
+		return nil, fmt.Errorf("invalid secret reference %q, expected <vault>/<name>[/<version>]", secret)
+	}
+
+	ref := &secretRef{
+		vaultURL: fmt.Sprintf("https://%s.%s", parts[0], dnsSuffix),
+		name:     parts[1],
+	}
+	if len(parts) == 3 {
+		ref.version = parts[2]
+	}
+	return ref, nil
+}
@@ -0,0 +1,409 @@
+package azkeyvault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+type testClient struct {
+	getSecretRef    *secretRef
+	getSecretReturn string
+	getSecretErr    error
+	closeCalled     bool
+}
+
+func (tc *testClient) GetSecret(ctx context.Context, ref *secretRef) (string, error) {
+	tc.getSecretRef = ref
+	if tc.getSecretErr != nil {
+		return "", tc.getSecretErr
+	}
+
+	return tc.getSecretReturn, nil
+}
+
+func (tc *testClient) Close() error {
+	tc.closeCalled = true
+	return nil
+}
+
+const testResource = "https://vault.azure.net"
+
+type staticCredential string
+
+func (s staticCredential) Token(ctx context.Context, resource string) (string, error) {
+	return string(s), nil
+}
+
+func TestDecrypt(t *testing.T) {
+	tc := &testClient{getSecretReturn: "superSecret"}
+	kv := &AzKeyVault{kvClient: tc, dnsSuffix: defaultDNSSuffix}
+
+	dec, err := kv.Decrypt(context.Background(), "myvault/db-password")
+	assert.NilError(t, err)
+	assert.Equal(t, dec, "superSecret")
+	assert.Equal(t, tc.getSecretRef.url(), "https://myvault.vault.azure.net/secrets/db-password")
+
+	tc.getSecretErr = errors.New("forbidden")
+	_, err = kv.Decrypt(context.Background(), "myvault/db-password")
+	assert.ErrorContains(t, err, "failed to get secret db-password: forbidden")
+
+	_, err = kv.Decrypt(context.Background(), "not-a-reference")
+	assert.ErrorContains(t, err, "invalid secret reference")
+}
+
+func TestClose(t *testing.T) {
+	tc := &testClient{}
+	kv := &AzKeyVault{kvClient: tc}
+
+	err := kv.Close()
+	assert.NilError(t, err)
+	assert.Equal(t, tc.closeCalled, true)
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	kv, err := New(staticCredential("token"))
+	assert.NilError(t, err)
+	assert.Assert(t, kv.httpClient != http.DefaultClient)
+	assert.Equal(t, kv.kvClient.(*restClient).ownsClient, true)
+
+	c := &http.Client{}
+	kv, err = New(staticCredential("token"), WithHTTPClient(c))
+	assert.NilError(t, err)
+	assert.Equal(t, kv.httpClient, c)
+	assert.Equal(t, kv.kvClient.(*restClient).ownsClient, false)
+	assert.NilError(t, kv.Close())
+}
+
+func TestNewResource(t *testing.T) {
+	kv, err := New(staticCredential("token"))
+	assert.NilError(t, err)
+	assert.Equal(t, kv.kvClient.(*restClient).resource, testResource)
+
+	kv, err = New(staticCredential("token"), WithDNSSuffix("vault.azure.cn"))
+	assert.NilError(t, err)
+	assert.Equal(t, kv.kvClient.(*restClient).resource, "https://vault.azure.cn")
+}
+
+func TestParseSecretRef(t *testing.T) {
+	tt := []struct {
+		name        string
+		secret      string
+		dnsSuffix   string
+		expectedURL string
+		expectedErr error
+	}{
+		{
+			name:        "full identifier",
+			secret:      "https://myvault.vault.azure.net/secrets/db-password",
+			expectedURL: "https://myvault.vault.azure.net/secrets/db-password",
+		},
+		{
+			name:        "full identifier with version",
+			secret:      "https://myvault.vault.azure.net/secrets/db-password/0123abcd",
+			expectedURL: "https://myvault.vault.azure.net/secrets/db-password/0123abcd",
+		},
+		{
+			name:        "short reference",
+			secret:      "myvault/db-password",
+			expectedURL: "https://myvault.vault.azure.net/secrets/db-password",
+		},
+		{
+			name:        "short reference with version",
+			secret:      "myvault/db-password/0123abcd",
+			expectedURL: "https://myvault.vault.azure.net/secrets/db-password/0123abcd",
+		},
+		{
+			name:        "short reference with dns suffix",
+			secret:      "myvault/db-password",
+			dnsSuffix:   "vault.azure.cn",
+			expectedURL: "https://myvault.vault.azure.cn/secrets/db-password",
+		},
+		{
+			name:        "identifier with upper case host",
+			secret:      "https://MyVault.Vault.Azure.Net/secrets/db-password",
+			expectedURL: "https://myvault.vault.azure.net/secrets/db-password",
+		},
+		{
+			name:        "identifier in dns suffix",
+			secret:      "https://myvault.vault.azure.cn/secrets/db-password",
+			dnsSuffix:   "vault.azure.cn",
+			expectedURL: "https://myvault.vault.azure.cn/secrets/db-password",
+		},
+		{
+			name:        "http identifier",
+			secret:      "http://myvault.vault.azure.net/secrets/db-password",
+			expectedErr: errors.New("scheme must be https"),
+		},
+		{
+			name:        "identifier with foreign host",
+			secret:      "https://attacker.example.com/secrets/db-password",
+			expectedErr: errors.New("host must be a vault in vault.azure.net"),
+		},
+		{
+			name:        "identifier with host in other dns suffix",
+			secret:      "https://myvault.vault.azure.net/secrets/db-password",
+			dnsSuffix:   "vault.azure.cn",
+			expectedErr: errors.New("host must be a vault in vault.azure.cn"),
+		},
+		{
+			name:        "identifier with host ending in dns suffix",
+			secret:      "https://attacker.example.com.vault.azure.net/secrets/db-password",
+			expectedErr: errors.New("host must be a vault in vault.azure.net"),
+		},
+		{
+			name:        "identifier with port",
+			secret:      "https://myvault.vault.azure.net:8443/secrets/db-password",
+			expectedErr: errors.New("host must be a vault in vault.azure.net"),
+		},
+		{
+			name:        "identifier without secrets path",
+			secret:      "https://myvault.vault.azure.net/keys/db-password",
+			expectedErr: errors.New("invalid secret identifier"),
+		},
+		{
+			name:        "identifier without name",
+			secret:      "https://myvault.vault.azure.net/secrets/",
+			expectedErr: errors.New("invalid secret identifier"),
+		},
+		{
+			name:        "short reference without name",
+			secret:      "myvault/",
+			expectedErr: errors.New("invalid secret reference"),
+		},
+		{
+			name:        "short reference with invalid vault name",
+			secret:      "attacker.example.com?/db-password",
+			expectedErr: errors.New("invalid secret reference"),
+		},
+		{
+			name:        "short reference too long",
+			secret:      "myvault/a/b/c",
+			expectedErr: errors.New("invalid secret reference"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			suffix := tc.dnsSuffix
+			if suffix == "" {
+				suffix = defaultDNSSuffix
+			}
+
+			ref, err := parseSecretRef(tc.secret, suffix)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, ref.url(), tc.expectedURL)
+		})
+	}
+}
+
+// vaultTransport sends the requests made to any vault to a test server.
+type vaultTransport struct {
+	srv *httptest.Server
+}
+
+func (vt *vaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, err := url.Parse(vt.srv.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return vt.srv.Client().Transport.RoundTrip(req)
+}
+
+// newFakeKeyVault returns a server emulating the Key Vault get secret REST API.
+func newFakeKeyVault(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api-version") != apiVersion {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer good-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"code":"Unauthorized","message":"AKV10000: Request is missing a Bearer token."}}`)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/secrets/db-password":
+			fmt.Fprint(w, `{"value":"latest-value","id":"x"}`)
+		case "/secrets/db-password/v1":
+			fmt.Fprint(w, `{"value":"v1-value","id":"x"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":"SecretNotFound","message":"A secret with that name was not found."}}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDecryptREST(t *testing.T) {
+	srv := newFakeKeyVault(t)
+
+	tt := []struct {
+		name        string
+		token       string
+		secret      string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "latest version",
+			token:    "good-token",
+			secret:   "https://myvault.vault.azure.net/secrets/db-password",
+			expected: "latest-value",
+		},
+		{
+			name:     "specific version",
+			token:    "good-token",
+			secret:   "myvault/db-password/v1",
+			expected: "v1-value",
+		},
+		{
+			name:        "not found",
+			token:       "good-token",
+			secret:      "myvault/missing",
+			expectedErr: errors.New("SecretNotFound"),
+		},
+		{
+			name:        "unauthorized",
+			token:       "bad-token",
+			secret:      "myvault/db-password",
+			expectedErr: errors.New("status 401: Unauthorized"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			kv, err := New(staticCredential(tc.token), WithHTTPClient(&http.Client{Transport: &vaultTransport{srv}}))
+			assert.NilError(t, err)
+			defer kv.Close()
+
+			dec, err := kv.Decrypt(context.Background(), tc.secret)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, dec, tc.expected)
+		})
+	}
+}
+
+func TestNewNilCredential(t *testing.T) {
+	kv, err := New(nil)
+	assert.Assert(t, kv == nil)
+	assert.ErrorContains(t, err, "credential is nil")
+}
+
+func TestManagedIdentityCredential(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		q := r.URL.Query()
+		resource := q.Get("resource")
+		if r.Header.Get("Metadata") != "true" || (resource != testResource && resource != "https://vault.azure.cn") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if q.Get("client_id") == "unknown" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_request","error_description":"Identity not found"}`)
+			return
+		}
+		// IMDS returns expires_in as a string
+		fmt.Fprint(w, `{"access_token":"mi-token","expires_in":"3599","token_type":"Bearer"}`)
+	}))
+	defer srv.Close()
+
+	cred := ManagedIdentityCredential("").(*managedIdentityCredential)
+	cred.endpoint = srv.URL
+	cred.httpClient = srv.Client()
+
+	token, err := cred.Token(context.Background(), testResource)
+	assert.NilError(t, err)
+	assert.Equal(t, token, "mi-token")
+
+	// cached
+	_, err = cred.Token(context.Background(), testResource)
+	assert.NilError(t, err)
+	assert.Equal(t, calls, 1)
+
+	// tokens are cached per resource
+	_, err = cred.Token(context.Background(), "https://vault.azure.cn")
+	assert.NilError(t, err)
+	assert.Equal(t, calls, 2)
+
+	unknown := ManagedIdentityCredential("unknown").(*managedIdentityCredential)
+	unknown.endpoint = srv.URL
+	unknown.httpClient = srv.Client()
+
+	_, err = unknown.Token(context.Background(), testResource)
+	assert.ErrorContains(t, err, "Identity not found")
+}
+
+func TestClientSecretCredential(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path != "/tenant/oauth2/v2.0/token" || r.PostForm.Get("scope") != testResource+"/.default" ||
+			r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("client_secret") != "shh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"sp-token","expires_in":3599,"token_type":"Bearer"}`)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	cred := ClientSecretCredential("tenant", "client", "shh", WithAuthorityHost(srv.URL)).(*clientSecretCredential)
+	cred.httpClient = srv.Client()
+	cred.cache.now = func() time.Time { return now }
+
+	token, err := cred.Token(context.Background(), testResource)
+	assert.NilError(t, err)
+	assert.Equal(t, token, "sp-token")
+
+	_, err = cred.Token(context.Background(), testResource)
+	assert.NilError(t, err)
+	assert.Equal(t, calls, 1)
+
+	// token is refreshed when it is about to expire
+	now = now.Add(time.Hour - time.Minute)
+	_, err = cred.Token(context.Background(), testResource)
+	assert.NilError(t, err)
+	assert.Equal(t, calls, 2)
+
+	bad := ClientSecretCredential("tenant", "client", "wrong", WithAuthorityHost(srv.URL)).(*clientSecretCredential)
+	bad.httpClient = srv.Client()
+
+	_, err = bad.Token(context.Background(), testResource)
+	assert.Assert(t, err != nil)
+	assert.Assert(t, strings.Contains(err.Error(), "invalid_client"))
+}
@@ -0,0 +1,83 @@
+package azkeyvault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const apiVersion = "7.4"
+
+type keyVaultClient interface {
+	GetSecret(ctx context.Context, ref *secretRef) (string, error)
+	Close() error
+}
+
+// restClient is a keyVaultClient for the Key Vault REST API.
+type restClient struct {
+	cred Credential
+	// resource is the Key Vault resource tokens are requested for
+	resource   string
+	httpClient *http.Client
+	ownsClient bool
+}
+
+type secretBundle struct {
+	Value string `json:"value"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *restClient) GetSecret(ctx context.Context, ref *secretRef) (string, error) {
+	token, err := c.cred.Token(ctx, c.resource)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref.url()+"?api-version="+apiVersion, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp errorResponse
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Code != "" {
+			return "", fmt.Errorf("status %d: %s: %s", resp.StatusCode, errResp.Error.Code, errResp.Error.Message)
+		}
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var bundle secretBundle
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return bundle.Value, nil
+}
+
+func (c *restClient) Close() error {
+	if c.ownsClient {
+		c.httpClient.CloseIdleConnections()
+	}
+	return nil
+}
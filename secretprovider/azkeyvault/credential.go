@@ -0,0 +1,208 @@
+package azkeyvault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	imdsTokenEndpoint    = "http://169.254.169.254/metadata/identity/oauth2/token"
+	imdsAPIVersion       = "2018-02-01"
+	defaultAuthorityHost = "https://login.microsoftonline.com"
+	// tokens are refreshed this long before they expire
+	expiryDelta = 2 * time.Minute
+)
+
+// Credential provides the bearer tokens used to authenticate requests to Key Vault.
+type Credential interface {
+	// Token returns a token for resource, the Key Vault resource of the cloud the vaults are
+	// in, e.g. https://vault.azure.net.
+	Token(ctx context.Context, resource string) (string, error)
+}
+
+type tokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+// fetchFunc requests a token for resource.
+type fetchFunc func(ctx context.Context, resource string) (*tokenResponse, error)
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// tokenCache caches the token of each resource until shortly before it expires.
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+	now    func() time.Time
+}
+
+func (c *tokenCache) get(ctx context.Context, resource string, fetch fetchFunc) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+
+	if t, ok := c.tokens[resource]; ok && now().Add(expiryDelta).Before(t.expires) {
+		return t.token, nil
+	}
+
+	resp, err := fetch(ctx, resource)
+	if err != nil {
+		return "", err
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("token response did not contain an access token")
+	}
+
+	expiresIn, err := strconv.Atoi(resp.ExpiresIn.String())
+	if err != nil {
+		return "", fmt.Errorf("invalid expires_in %q: %w", resp.ExpiresIn, err)
+	}
+
+	if c.tokens == nil {
+		c.tokens = make(map[string]cachedToken)
+	}
+	c.tokens[resource] = cachedToken{
+		token:   resp.AccessToken,
+		expires: now().Add(time.Duration(expiresIn) * time.Second),
+	}
+	return resp.AccessToken, nil
+}
+
+type managedIdentityCredential struct {
+	clientID   string
+	endpoint   string
+	httpClient *http.Client
+	cache      tokenCache
+}
+
+// ManagedIdentityCredential returns a Credential that requests tokens from the Azure
+// Instance Metadata Service. clientID selects a user-assigned identity and may be
+// empty to use the system-assigned identity.
+func ManagedIdentityCredential(clientID string) Credential {
+	return &managedIdentityCredential{
+		clientID:   clientID,
+		endpoint:   imdsTokenEndpoint,
+		httpClient: http.DefaultClient,
+	}
+}
+
+func (m *managedIdentityCredential) Token(ctx context.Context, resource string) (string, error) {
+	return m.cache.get(ctx, resource, m.fetch)
+}
+
+func (m *managedIdentityCredential) fetch(ctx context.Context, resource string) (*tokenResponse, error) {
+	q := url.Values{}
+	q.Set("api-version", imdsAPIVersion)
+	q.Set("resource", resource)
+	if m.clientID != "" {
+		q.Set("client_id", m.clientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Metadata", "true")
+
+	return doTokenRequest(m.httpClient, req, "managed identity")
+}
+
+type clientSecretCredential struct {
+	tenantID      string
+	clientID      string
+	clientSecret  string
+	authorityHost string
+	httpClient    *http.Client
+	cache         tokenCache
+}
+
+// ClientSecretOption represents a function that can be passed into ClientSecretCredential to
+// modify the behavior of the credential.
+type ClientSecretOption func(c *clientSecretCredential)
+
+// WithAuthorityHost sets the Azure AD authority host tokens are requested from, e.g.
+// https://login.chinacloudapi.cn for Azure China. It defaults to https://login.microsoftonline.com.
+func WithAuthorityHost(host string) ClientSecretOption {
+	return func(c *clientSecretCredential) {
+		c.authorityHost = host
+	}
+}
+
+// ClientSecretCredential returns a Credential that authenticates a service principal
+// with a client secret using the OAuth2 client credentials flow.
+func ClientSecretCredential(tenantID, clientID, clientSecret string, options ...ClientSecretOption) Credential {
+	c := &clientSecretCredential{
+		tenantID:      tenantID,
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		authorityHost: defaultAuthorityHost,
+		httpClient:    http.DefaultClient,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+func (c *clientSecretCredential) Token(ctx context.Context, resource string) (string, error) {
+	return c.cache.get(ctx, resource, c.fetch)
+}
+
+func (c *clientSecretCredential) fetch(ctx context.Context, resource string) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", c.clientSecret)
+	form.Set("scope", resource+"/.default")
+
+	endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token",
+		strings.TrimSuffix(c.authorityHost, "/"), url.PathEscape(c.tenantID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return doTokenRequest(c.httpClient, req, "client secret")
+}
+
+func doTokenRequest(c *http.Client, req *http.Request, kind string) (*tokenResponse, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s token request failed: %w", kind, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s token response: %w", kind, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s token request failed: status %d: %s",
+			kind, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return nil, fmt.Errorf("failed to decode %s token response: %w", kind, err)
+	}
+
+	return &tr, nil
+}
@@ -0,0 +1,260 @@
+// Package exec contains the secretprovider implementation that resolves secrets
+// by running an external plugin binary. It allows any secret store to be used
+// without adding a provider to serum.
+//
+// A plugin is run once per secret. The secret reference is passed either as the
+// last argument or on stdin, and the plugin writes the plain text value to stdout.
+// A single trailing newline is removed from the output. A non zero exit code is
+// treated as a failure and stderr is included in the returned error.
+//
+// In batch mode the plugin is run once for all secrets of an Injector. It receives
+// a JSON request on stdin:
+//
+//	{"secrets": ["ref1", "ref2"]}
+//
+// and writes a JSON response to stdout:
+//
+//	{"secrets": {"ref1": "value1"}, "errors": {"ref2": "not found"}}
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the default amount of time a plugin is allowed to run.
+	DefaultTimeout = 30 * time.Second
+	// DefaultMaxOutputSize is the default maximum number of bytes read from a plugin's stdout.
+	DefaultMaxOutputSize = 1 << 20
+	// maxStderrSize is the maximum number of bytes of stderr included in errors.
+	maxStderrSize = 4 << 10
+)
+
+// Mode determines how secret references are passed to the plugin.
+type Mode int
+
+// Supported plugin modes.
+const (
+	// ModeArgument passes the secret reference as the last argument.
+	ModeArgument Mode = iota
+	// ModeStdin writes the secret reference to stdin.
+	ModeStdin
+	// ModeBatch writes a JSON request with all secret references to stdin.
+	ModeBatch
+)
+
+// Option represents a function that can be passed into New to modify
+// the behavior of the Exec provider.
+type Option func(e *Exec)
+
+// WithMode sets how secret references are passed to the plugin. It defaults to ModeArgument.
+func WithMode(m Mode) Option {
+	return func(e *Exec) {
+		e.mode = m
+	}
+}
+
+// WithTimeout sets the maximum amount of time a single plugin run may take.
+func WithTimeout(d time.Duration) Option {
+	return func(e *Exec) {
+		e.timeout = d
+	}
+}
+
+// WithMaxOutputSize sets the maximum number of bytes read from the plugin's stdout.
+// Plugins writing more than this fail.
+func WithMaxOutputSize(n int64) Option {
+	return func(e *Exec) {
+		e.maxOutputSize = n
+	}
+}
+
+// WithEnv sets additional env variables, in the form key=value, passed to the plugin.
+func WithEnv(env ...string) Option {
+	return func(e *Exec) {
+		e.env = append(e.env, env...)
+	}
+}
+
+// Exec is a secret provider that runs an external plugin binary to decrypt secrets.
+type Exec struct {
+	command       string
+	args          []string
+	mode          Mode
+	timeout       time.Duration
+	maxOutputSize int64
+	env           []string
+}
+
+// New returns an initialized Exec provider that runs command with args.
+func New(command string, args []string, options ...Option) (*Exec, error) {
+	if command == "" {
+		return nil, fmt.Errorf("exec: command is empty")
+	}
+
+	path, err := osexec.LookPath(command)
+	if err != nil {
+		return nil, fmt.Errorf("exec: %w", err)
+	}
+
+	e := &Exec{
+		command:       path,
+		args:          args,
+		timeout:       DefaultTimeout,
+		maxOutputSize: DefaultMaxOutputSize,
+	}
+	for _, option := range options {
+		option(e)
+	}
+
+	return e, nil
+}
+
+// Decrypt will run the plugin and return the plain text string it writes to stdout.
+func (e *Exec) Decrypt(ctx context.Context, secret string) (string, error) {
+	switch e.mode {
+	case ModeBatch:
+		values, err := e.DecryptBatch(ctx, []string{secret})
+		if err != nil {
+			return "", err
+		}
+		return values[secret], nil
+	case ModeStdin:
+		out, err := e.run(ctx, e.args, strings.NewReader(secret))
+		if err != nil {
+			return "", err
+		}
+		return trimNewline(out), nil
+	default:
+		args := append(e.args[:len(e.args):len(e.args)], secret)
+		out, err := e.run(ctx, args, nil)
+		if err != nil {
+			return "", err
+		}
+		return trimNewline(out), nil
+	}
+}
+
+type batchRequest struct {
+	Secrets []string `json:"secrets"`
+}
+
+type batchResponse struct {
+	Secrets map[string]string `json:"secrets"`
+	Errors  map[string]string `json:"errors"`
+}
+
+// DecryptBatch runs the plugin once using the batch JSON protocol and returns the plain
+// text values keyed by secret. It returns an error if any secret could not be decrypted.
+// In modes other than ModeBatch the plugin is run once per secret.
+func (e *Exec) DecryptBatch(ctx context.Context, secrets []string) (map[string]string, error) {
+	if e.mode != ModeBatch {
+		values := make(map[string]string, len(secrets))
+		for _, s := range secrets {
+			v, err := e.Decrypt(ctx, s)
+			if err != nil {
+				return nil, err
+			}
+			values[s] = v
+		}
+		return values, nil
+	}
+
+	req, err := json.Marshal(&batchRequest{Secrets: secrets})
+	if err != nil {
+		return nil, fmt.Errorf("exec: failed to encode batch request: %w", err)
+	}
+
+	out, err := e.run(ctx, e.args, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp batchResponse
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		return nil, fmt.Errorf("exec: failed to decode batch response: %w", err)
+	}
+
+	for _, s := range secrets {
+		if msg, ok := resp.Errors[s]; ok {
+			return nil, fmt.Errorf("exec: failed to decrypt secret %s: %s", s, msg)
+		}
+		if _, ok := resp.Secrets[s]; !ok {
+			return nil, fmt.Errorf("exec: secret %s missing from batch response", s)
+		}
+	}
+
+	return resp.Secrets, nil
+}
+
+// Close is a no-op, plugins do not outlive a single call.
+func (e *Exec) Close() error {
+	return nil
+}
+
+// limitedWriter buffers up to limit bytes. Writing more than limit marks the writer
+// as exceeded and calls onExceed, if set, so the plugin can be stopped.
+type limitedWriter struct {
+	buf      bytes.Buffer
+	limit    int64
+	exceeded bool
+	onExceed func()
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	remaining := w.limit - int64(w.buf.Len())
+	if int64(len(p)) <= remaining {
+		return w.buf.Write(p)
+	}
+
+	if remaining > 0 {
+		w.buf.Write(p[:remaining])
+	}
+	if !w.exceeded && w.onExceed != nil {
+		w.onExceed()
+	}
+	w.exceeded = true
+	return len(p), nil
+}
+
+func (e *Exec) run(ctx context.Context, args []string, stdin io.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	stdout := &limitedWriter{limit: e.maxOutputSize, onExceed: cancel}
+	stderr := &limitedWriter{limit: maxStderrSize}
+
+	cmd := osexec.CommandContext(ctx, e.command, args...) //nolint:gosec
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = append(os.Environ(), e.env...)
+
+	err := cmd.Run()
+	switch {
+	case stdout.exceeded:
+		return "", fmt.Errorf("exec: plugin output exceeds %d bytes", e.maxOutputSize)
+	case ctx.Err() == context.DeadlineExceeded:
+		return "", fmt.Errorf("exec: plugin timed out after %s", e.timeout)
+	case err != nil:
+		if msg := strings.TrimSpace(stderr.buf.String()); msg != "" {
+			return "", fmt.Errorf("exec: plugin failed: %s: %s", err, msg)
+		}
+		return "", fmt.Errorf("exec: plugin failed: %s", err)
+	}
+
+	return stdout.buf.String(), nil
+}
+
+func trimNewline(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return strings.TrimSuffix(s, "\r")
+}
@@ -0,0 +1,182 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// writePlugin writes a shell script plugin to a temporary directory and returns its path.
+func writePlugin(t *testing.T, script string) string {
+	path := filepath.Join(t.TempDir(), "plugin.sh")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0700); err != nil { //nolint:gosec
+		t.Fatalf("error writing plugin: %s", err)
+	}
+
+	return path
+}
+
+func TestDecrypt(t *testing.T) {
+	tt := []struct {
+		name        string
+		script      string
+		args        []string
+		options     []Option
+		secret      string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "argument",
+			script:   `echo "value-of-$2"`,
+			args:     []string{"--ref"},
+			secret:   "db-password",
+			expected: "value-of-db-password",
+		},
+		{
+			name:     "stdin",
+			script:   `read ref; printf "value-of-%s" "$ref"`,
+			options:  []Option{WithMode(ModeStdin)},
+			secret:   "db-password",
+			expected: "value-of-db-password",
+		},
+		{
+			name:     "only one trailing newline is removed",
+			script:   `printf "line1\nline2\n\n"`,
+			secret:   "multiline",
+			expected: "line1\nline2\n",
+		},
+		{
+			name:     "env",
+			script:   `printf "%s" "$PLUGIN_TOKEN"`,
+			options:  []Option{WithEnv("PLUGIN_TOKEN=abc")},
+			secret:   "token",
+			expected: "abc",
+		},
+		{
+			name:        "failure includes stderr",
+			script:      `echo "secret $1 not found" >&2; exit 3`,
+			secret:      "missing",
+			expectedErr: errors.New("exit status 3: secret missing not found"),
+		},
+		{
+			name:        "timeout",
+			script:      `exec sleep 5`,
+			options:     []Option{WithTimeout(50 * time.Millisecond)},
+			secret:      "slow",
+			expectedErr: errors.New("plugin timed out after 50ms"),
+		},
+		{
+			name:        "output too large",
+			script:      `while true; do echo aaaaaaaaaaaaaaaa; done`,
+			options:     []Option{WithMaxOutputSize(64)},
+			secret:      "large",
+			expectedErr: errors.New("plugin output exceeds 64 bytes"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := New(writePlugin(t, tc.script), tc.args, tc.options...)
+			assert.NilError(t, err)
+			defer e.Close()
+
+			dec, err := e.Decrypt(context.Background(), tc.secret)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, dec, tc.expected)
+		})
+	}
+}
+
+const batchPlugin = `
+read req
+case "$req" in
+  *bad-json*) echo "not json" ;;
+  *missing*) echo '{"secrets":{"a":"1"},"errors":{"missing":"not found"}}' ;;
+  *dropped*) echo '{"secrets":{"a":"1"}}' ;;
+  *) echo '{"secrets":{"a":"1","b":"2"}}' ;;
+esac
+echo "$req" > "$1"
+`
+
+func TestDecryptBatch(t *testing.T) {
+	tt := []struct {
+		name        string
+		secrets     []string
+		expected    map[string]string
+		expectedErr error
+	}{
+		{
+			name:     "success",
+			secrets:  []string{"a", "b"},
+			expected: map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:        "error for secret",
+			secrets:     []string{"a", "missing"},
+			expectedErr: errors.New("failed to decrypt secret missing: not found"),
+		},
+		{
+			name:        "secret missing from response",
+			secrets:     []string{"a", "dropped"},
+			expectedErr: errors.New("secret dropped missing from batch response"),
+		},
+		{
+			name:        "bad response",
+			secrets:     []string{"bad-json"},
+			expectedErr: errors.New("failed to decode batch response"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reqPath := filepath.Join(t.TempDir(), "request.json")
+			e, err := New(writePlugin(t, batchPlugin), []string{reqPath}, WithMode(ModeBatch))
+			assert.NilError(t, err)
+
+			values, err := e.DecryptBatch(context.Background(), tc.secrets)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.DeepEqual(t, values, tc.expected)
+
+			req, err := ioutil.ReadFile(reqPath)
+			assert.NilError(t, err)
+			assert.Equal(t, string(req), `{"secrets":["a","b"]}`+"\n")
+
+			dec, err := e.Decrypt(context.Background(), "b")
+			assert.NilError(t, err)
+			assert.Equal(t, dec, "2")
+		})
+	}
+}
+
+func TestDecryptBatchSingleMode(t *testing.T) {
+	e, err := New(writePlugin(t, `printf "v-%s" "$1"`), nil)
+	assert.NilError(t, err)
+
+	values, err := e.DecryptBatch(context.Background(), []string{"a", "b"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, map[string]string{"a": "v-a", "b": "v-b"})
+}
+
+func TestNewError(t *testing.T) {
+	_, err := New("", nil)
+	assert.ErrorContains(t, err, "command is empty")
+
+	_, err = New(filepath.Join(t.TempDir(), "missing-plugin"), nil)
+	assert.ErrorContains(t, err, "exec:")
+}
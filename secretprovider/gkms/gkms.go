@@ -0,0 +1,230 @@
+// Package gkms contains the secretprovider implementation for secrets that are
+// stored inline as ciphertext and decrypted with GCP's Cloud KMS.
+package gkms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+const (
+	refPrefix      = "kms:"
+	envelopeMarker = "env"
+	refSeparator   = ":"
+	dekSize        = 32
+	// MaxDirectPlaintext is the largest plaintext that Encrypt will send to Cloud KMS
+	// directly. Larger values are envelope encrypted.
+	MaxDirectPlaintext = 64 * 1024
+)
+
+type kmsClient interface {
+	Encrypt(ctx context.Context, req *kmspb.EncryptRequest,
+		opts ...gax.CallOption) (*kmspb.EncryptResponse, error)
+	Decrypt(ctx context.Context, req *kmspb.DecryptRequest,
+		opts ...gax.CallOption) (*kmspb.DecryptResponse, error)
+	Close() error
+}
+
+// GKMS is a secret provider that decrypts inline ciphertexts using Google Cloud Platform's
+// Cloud KMS. Internally it uses the Google Cloud SDK.
+//
+// Secrets are referenced as kms:<key>:<ciphertext> where key is the full resource name of a
+// crypto key and ciphertext is the base64 encoded output of Cloud KMS. Large values are
+// envelope encrypted and referenced as kms:<key>:env:<wrapped key>:<ciphertext>, where wrapped
+// key is a base64 encoded AES-256 data key encrypted by Cloud KMS and ciphertext is the base64
+// encoded AES-GCM nonce and ciphertext of the value.
+type GKMS struct {
+	kmsClient kmsClient
+}
+
+// New returns an initialized GKMS using a new key management client.
+func New(ctx context.Context) (*GKMS, error) {
+	c, err := kms.NewKeyManagementClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gkms: failed to initialize client: %w", err)
+	}
+
+	return &GKMS{kmsClient: c}, nil
+}
+
+// Decrypt will decrypt the inline ciphertext using Cloud KMS and return the plain text string.
+func (g *GKMS) Decrypt(ctx context.Context, secret string) (string, error) {
+	ref, err := parseRef(secret)
+	if err != nil {
+		return "", fmt.Errorf("gkms: %w", err)
+	}
+
+	if ref.wrappedKey == nil {
+		plain, err := g.decrypt(ctx, ref.keyName, ref.ciphertext)
+		if err != nil {
+			return "", err
+		}
+		return string(plain), nil
+	}
+
+	dek, err := g.decrypt(ctx, ref.keyName, ref.wrappedKey)
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := openEnvelope(dek, ref.ciphertext, ref.keyName)
+	if err != nil {
+		return "", fmt.Errorf("gkms: failed to decrypt envelope: %w", err)
+	}
+
+	return string(plain), nil
+}
+
+// Encrypt encrypts plaintext with the crypto key keyName and returns a reference that can be
+// used as a secret in a .env file. Plaintexts larger than MaxDirectPlaintext are envelope encrypted.
+func (g *GKMS) Encrypt(ctx context.Context, keyName string, plaintext []byte) (string, error) {
+	if len(plaintext) > MaxDirectPlaintext {
+		return g.EncryptEnvelope(ctx, keyName, plaintext)
+	}
+
+	ct, err := g.encrypt(ctx, keyName, plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return refPrefix + keyName + refSeparator + base64.StdEncoding.EncodeToString(ct), nil
+}
+
+// EncryptEnvelope encrypts plaintext with a new AES-256-GCM data key which is then encrypted
+// with the crypto key keyName. It returns a reference that can be used as a secret in a .env file.
+func (g *GKMS) EncryptEnvelope(ctx context.Context, keyName string, plaintext []byte) (string, error) {
+	dek := make([]byte, dekSize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", fmt.Errorf("gkms: failed to generate data key: %w", err)
+	}
+
+	sealed, err := sealEnvelope(dek, plaintext, keyName)
+	if err != nil {
+		return "", fmt.Errorf("gkms: failed to encrypt envelope: %w", err)
+	}
+
+	wrapped, err := g.encrypt(ctx, keyName, dek)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		refPrefix + keyName,
+		envelopeMarker,
+		base64.StdEncoding.EncodeToString(wrapped),
+		base64.StdEncoding.EncodeToString(sealed),
+	}, refSeparator), nil
+}
+
+// Close closes the connection to the Cloud KMS API.
+func (g *GKMS) Close() error {
+	return g.kmsClient.Close()
+}
+
+func (g *GKMS) encrypt(ctx context.Context, keyName string, plaintext []byte) ([]byte, error) {
+	resp, err := g.kmsClient.Encrypt(ctx, &kmspb.EncryptRequest{
+		Name:      keyName,
+		Plaintext: plaintext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gkms: failed to encrypt with key %s: %w", keyName, err)
+	}
+
+	return resp.Ciphertext, nil
+}
+
+func (g *GKMS) decrypt(ctx context.Context, keyName string, ciphertext []byte) ([]byte, error) {
+	resp, err := g.kmsClient.Decrypt(ctx, &kmspb.DecryptRequest{
+		Name:       keyName,
+		Ciphertext: ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gkms: failed to decrypt with key %s: %w", keyName, err)
+	}
+
+	return resp.Plaintext, nil
+}
+
+type ref struct {
+	keyName    string
+	wrappedKey []byte
+	ciphertext []byte
+}
+
+func parseRef(secret string) (*ref, error) {
+	if !strings.HasPrefix(secret, refPrefix) {
+		return nil, fmt.Errorf("invalid secret reference: missing %q prefix", refPrefix)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(secret, refPrefix), refSeparator)
+	switch {
+	case len(parts) == 2 && parts[0] != "":
+		ct, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ciphertext: %w", err)
+		}
+		return &ref{keyName: parts[0], ciphertext: ct}, nil
+	case len(parts) == 4 && parts[0] != "" && parts[1] == envelopeMarker:
+		wrapped, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid wrapped data key: %w", err)
+		}
+		ct, err := base64.StdEncoding.DecodeString(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ciphertext: %w", err)
+		}
+		return &ref{keyName: parts[0], wrappedKey: wrapped, ciphertext: ct}, nil
+	default:
+		return nil, fmt.Errorf("invalid secret reference, expected kms:<key>:<ciphertext> or " +
+			"kms:<key>:env:<wrapped key>:<ciphertext>")
+	}
+}
+
+// sealEnvelope encrypts plaintext with AES-GCM using the data key. The key name is used as
+// additional authenticated data so an envelope cannot be moved to a different key.
+func sealEnvelope(dek, plaintext []byte, keyName string) ([]byte, error) {
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, []byte(keyName)), nil
+}
+
+func openEnvelope(dek, sealed []byte, keyName string) ([]byte, error) {
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ct := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ct, []byte(keyName))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
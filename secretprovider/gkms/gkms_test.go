@@ -0,0 +1,192 @@
+package gkms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/googleapis/gax-go/v2"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"gotest.tools/v3/assert"
+)
+
+const (
+	testKey      = "projects/p/locations/l/keyRings/r/cryptoKeys/k"
+	testOtherKey = "projects/p/locations/l/keyRings/r/cryptoKeys/other"
+)
+
+// testClient emulates Cloud KMS by sealing plaintexts with a fixed AES key,
+// bound to the crypto key name.
+type testClient struct {
+	masterKey    []byte
+	encryptCalls int
+	decryptCalls int
+	decryptErr   error
+	closeCalled  bool
+}
+
+func newTestClient() *testClient {
+	return &testClient{masterKey: bytes.Repeat([]byte{7}, dekSize)}
+}
+
+func (tc *testClient) Encrypt(ctx context.Context, req *kmspb.EncryptRequest,
+	opts ...gax.CallOption) (*kmspb.EncryptResponse, error) {
+	tc.encryptCalls++
+	ct, err := sealEnvelope(tc.masterKey, req.Plaintext, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmspb.EncryptResponse{Name: req.Name, Ciphertext: ct}, nil
+}
+
+func (tc *testClient) Decrypt(ctx context.Context, req *kmspb.DecryptRequest,
+	opts ...gax.CallOption) (*kmspb.DecryptResponse, error) {
+	tc.decryptCalls++
+	if tc.decryptErr != nil {
+		return nil, tc.decryptErr
+	}
+
+	plain, err := openEnvelope(tc.masterKey, req.Ciphertext, req.Name)
+	if err != nil {
+		return nil, errors.New("invalid ciphertext")
+	}
+
+	return &kmspb.DecryptResponse{Plaintext: plain}, nil
+}
+
+func (tc *testClient) Close() error {
+	tc.closeCalled = true
+	return nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	large := strings.Repeat("a", MaxDirectPlaintext+1)
+
+	tt := []struct {
+		name           string
+		plaintext      string
+		envelope       bool
+		expectEnvelope bool
+	}{
+		{
+			name:      "direct",
+			plaintext: "superSecret",
+		},
+		{
+			name:           "forced envelope",
+			plaintext:      "superSecret",
+			envelope:       true,
+			expectEnvelope: true,
+		},
+		{
+			name:           "large value uses envelope",
+			plaintext:      large,
+			expectEnvelope: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newTestClient()
+			g := &GKMS{kmsClient: client}
+
+			var ref string
+			var err error
+			if tc.envelope {
+				ref, err = g.EncryptEnvelope(context.Background(), testKey, []byte(tc.plaintext))
+			} else {
+				ref, err = g.Encrypt(context.Background(), testKey, []byte(tc.plaintext))
+			}
+			assert.NilError(t, err)
+			assert.Assert(t, strings.HasPrefix(ref, "kms:"+testKey+":"))
+			assert.Equal(t, strings.Contains(ref, ":env:"), tc.expectEnvelope)
+
+			dec, err := g.Decrypt(context.Background(), ref)
+			assert.NilError(t, err)
+			assert.Equal(t, dec, tc.plaintext)
+			assert.Equal(t, client.decryptCalls, 1)
+		})
+	}
+}
+
+func TestDecryptError(t *testing.T) {
+	g := &GKMS{kmsClient: newTestClient()}
+	direct, err := g.Encrypt(context.Background(), testKey, []byte("value"))
+	assert.NilError(t, err)
+	envelope, err := g.EncryptEnvelope(context.Background(), testKey, []byte("value"))
+	assert.NilError(t, err)
+
+	envParts := strings.Split(envelope, ":")
+	otherEnvelope, err := g.EncryptEnvelope(context.Background(), testKey, []byte("other"))
+	assert.NilError(t, err)
+	otherParts := strings.Split(otherEnvelope, ":")
+
+	tt := []struct {
+		name        string
+		secret      string
+		decryptErr  error
+		expectedErr error
+	}{
+		{
+			name:        "missing prefix",
+			secret:      "projects/p/locations/l/keyRings/r/cryptoKeys/k:AAAA",
+			expectedErr: errors.New("missing \"kms:\" prefix"),
+		},
+		{
+			name:        "missing ciphertext",
+			secret:      "kms:" + testKey,
+			expectedErr: errors.New("invalid secret reference"),
+		},
+		{
+			name:        "bad base64",
+			secret:      "kms:" + testKey + ":not base64!",
+			expectedErr: errors.New("invalid ciphertext"),
+		},
+		{
+			name:        "bad envelope marker",
+			secret:      "kms:" + testKey + ":nope:AAAA:AAAA",
+			expectedErr: errors.New("invalid secret reference"),
+		},
+		{
+			name:        "wrong key",
+			secret:      strings.Replace(direct, testKey, testOtherKey, 1),
+			expectedErr: errors.New("failed to decrypt with key " + testOtherKey),
+		},
+		{
+			name: "swapped envelope ciphertext",
+			secret: strings.Join(append(envParts[:len(envParts)-1:len(envParts)-1],
+				otherParts[len(otherParts)-1]), ":"),
+			expectedErr: errors.New("failed to decrypt envelope"),
+		},
+		{
+			name:        "kms error",
+			secret:      direct,
+			decryptErr:  errors.New("permission denied"),
+			expectedErr: errors.New("permission denied"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newTestClient()
+			client.decryptErr = tc.decryptErr
+			g := &GKMS{kmsClient: client}
+
+			dec, err := g.Decrypt(context.Background(), tc.secret)
+			assert.Equal(t, dec, "")
+			assert.ErrorContains(t, err, tc.expectedErr.Error())
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	tc := newTestClient()
+	g := &GKMS{kmsClient: tc}
+
+	err := g.Close()
+	assert.NilError(t, err)
+	assert.Equal(t, tc.closeCalled, true)
+}
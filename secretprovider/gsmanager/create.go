@@ -0,0 +1,89 @@
+package gsmanager
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const versionsSegment = "/versions/"
+
+// AddVersion adds a version containing value to secret and returns the resource name of the new
+// version. The secret is created first if it does not exist, with automatic replication, or in
+// the region set using WithRegion. Secrets are referenced by their full resource name without a
+// version, projects/<project>/[locations/<location>/]secrets/<name>, or by their short name.
+func (g *GSManager) AddVersion(ctx context.Context, secret string, value []byte) (string, error) {
+	if strings.Contains(secret, versionSeparator) || strings.Contains(secret, versionsSegment) {
+		return "", fmt.Errorf("gsmanager: secret reference %q must not include a version", secret)
+	}
+
+	name, err := g.resourceName(ctx, secret)
+	if err != nil {
+		return "", fmt.Errorf("gsmanager: %w", err)
+	}
+	// other paths are passed through by resourceName but are not secrets that can be created
+	i := strings.LastIndex(name, versionsSegment)
+	if !strings.HasPrefix(name, resourcePrefix) || i < 0 {
+		return "", fmt.Errorf("gsmanager: invalid secret reference %q, expected <name> or "+
+			"projects/<project>/[locations/<location>/]secrets/<name>", secret)
+	}
+	name = name[:i]
+
+	version, err := g.addVersion(ctx, name, value)
+	if status.Code(err) == codes.NotFound {
+		if err := g.createSecret(ctx, name); err != nil {
+			return "", fmt.Errorf("gsmanager: failed to create secret: %w", err)
+		}
+		version, err = g.addVersion(ctx, name, value)
+	}
+	if err != nil {
+		return "", fmt.Errorf("gsmanager: failed to add secret version: %w", err)
+	}
+
+	return version, nil
+}
+
+func (g *GSManager) addVersion(ctx context.Context, name string, value []byte) (string, error) {
+	checksum := int64(crc32.Checksum(value, crc32cTable))
+	version, err := g.smClient.AddSecretVersion(ctx, &secretmanagerpb.AddSecretVersionRequest{
+		Parent: name,
+		Payload: &secretmanagerpb.SecretPayload{
+			Data:       value,
+			DataCrc32C: &checksum,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return version.GetName(), nil
+}
+
+// createSecret creates the secret name, a secret created concurrently is not an error.
+func (g *GSManager) createSecret(ctx context.Context, name string) error {
+	i := strings.LastIndex(name, "/secrets/")
+	req := &secretmanagerpb.CreateSecretRequest{
+		Parent:   name[:i],
+		SecretId: name[i+len("/secrets/"):],
+		Secret:   &secretmanagerpb.Secret{},
+	}
+	// regional secrets are stored in their location and don't have a replication policy
+	if !strings.Contains(req.Parent, "/locations/") {
+		req.Secret.Replication = &secretmanagerpb.Replication{
+			Replication: &secretmanagerpb.Replication_Automatic_{
+				Automatic: &secretmanagerpb.Replication_Automatic{},
+			},
+		}
+	}
+
+	_, err := g.smClient.CreateSecret(ctx, req)
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+	return err
+}
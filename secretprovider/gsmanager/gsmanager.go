@@ -5,49 +5,321 @@ package gsmanager
 import (
 	"context"
 	"fmt"
+	"hash/crc32"
+	"os"
+	"strings"
+	"sync"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"github.com/googleapis/gax-go/v2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
 	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/grpc"
 )
 
+const (
+	resourcePrefix     = "projects/"
+	versionSeparator   = "@"
+	defaultVersion     = "latest"
+	projectEnv         = "GOOGLE_CLOUD_PROJECT"
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+	regionalEndpoint   = "secretmanager.%s.rep.googleapis.com:443"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CorruptPayloadError is returned by Decrypt when the CRC32C checksum of a secret's payload
+// does not match the checksum returned by Secret Manager.
+type CorruptPayloadError struct {
+	Name     string
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *CorruptPayloadError) Error() string {
+	return fmt.Sprintf("payload of %s is corrupt: expected crc32c %d, got %d", e.Name, e.Expected, e.Actual)
+}
+
 type secretManagerClient interface {
 	AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest,
 		opts ...gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error)
+	ListSecrets(ctx context.Context, req *secretmanagerpb.ListSecretsRequest,
+		opts ...gax.CallOption) secretIterator
+	CreateSecret(ctx context.Context, req *secretmanagerpb.CreateSecretRequest,
+		opts ...gax.CallOption) (*secretmanagerpb.Secret, error)
+	AddSecretVersion(ctx context.Context, req *secretmanagerpb.AddSecretVersionRequest,
+		opts ...gax.CallOption) (*secretmanagerpb.SecretVersion, error)
 	Close() error
 }
 
+type secretIterator interface {
+	Next() (*secretmanagerpb.Secret, error)
+}
+
+// client adapts a secret manager client to the secretManagerClient interface.
+type client struct {
+	*secretmanager.Client
+}
+
+func (c *client) ListSecrets(ctx context.Context, req *secretmanagerpb.ListSecretsRequest,
+	opts ...gax.CallOption) secretIterator {
+	return c.Client.ListSecrets(ctx, req, opts...)
+}
+
+// Option represents a function that can be passed into New to modify
+// the behavior of the GSManager.
+type Option func(g *GSManager)
+
+// WithProject sets the project used to expand short secret references. When it is not set,
+// the project is detected from the GOOGLE_CLOUD_PROJECT env variable or the Application
+// Default Credentials, which includes the metadata server on GCP.
+func WithProject(project string) Option {
+	return func(g *GSManager) {
+		g.project = project
+	}
+}
+
+// WithDefaultVersion sets the version used when a secret reference does not specify one.
+// It defaults to latest.
+func WithDefaultVersion(version string) Option {
+	return func(g *GSManager) {
+		g.defaultVersion = version
+	}
+}
+
+// WithClientOptions sets the options used to create the secret manager client, e.g. credentials
+// files or impersonated service accounts. They are ignored by NewFromClient.
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(g *GSManager) {
+		g.clientOptions = append(g.clientOptions, opts...)
+	}
+}
+
+// WithRegion uses the regional Secret Manager endpoint of region and expands short secret
+// references into regional secrets, projects/<project>/locations/<region>/secrets/<name>.
+func WithRegion(region string) Option {
+	return func(g *GSManager) {
+		g.location = region
+		g.clientOptions = append(g.clientOptions, option.WithEndpoint(fmt.Sprintf(regionalEndpoint, region)))
+	}
+}
+
+// WithEmulator connects to a Secret Manager emulator or test server listening on addr,
+// without TLS or authentication.
+func WithEmulator(addr string) Option {
+	return func(g *GSManager) {
+		g.clientOptions = append(g.clientOptions,
+			option.WithEndpoint(addr),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithInsecure()),
+		)
+	}
+}
+
 // GSManager is a secret provider that communicates with Google Cloud Platform's Secret Manager
 // to decrypt secrets. Internally it uses the Google Cloud SDK.
+//
+// Secrets can be referenced by their full resource name,
+// projects/<project>/[locations/<location>/]secrets/<name>/versions/<version>, or by a short
+// reference, <name> or <name>@<version>, which is expanded using the default project and version.
 type GSManager struct {
-	smClient secretManagerClient
+	smClient       secretManagerClient
+	clientOptions  []option.ClientOption
+	project        string
+	location       string
+	defaultVersion string
+
+	detectProject func(ctx context.Context) (string, error)
+	projectOnce   sync.Once
+	projectErr    error
+
+	prefetchFilter      string
+	prefetchConcurrency int
+	prefetchMu          sync.Mutex
+	prefetched          map[string]string
+	prefetchProjects    map[string]bool
 }
 
 // New return's an initialized GSManager using a new secret manager client.
-func New(ctx context.Context) (*GSManager, error) {
-	c, err := secretmanager.NewClient(ctx)
+func New(ctx context.Context, options ...Option) (*GSManager, error) {
+	g := newGSManager(nil, options...)
+
+	c, err := secretmanager.NewClient(ctx, g.clientOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("gsmanager: failed to initialize client: %w", err)
 	}
 
-	return &GSManager{smClient: c}, nil
+	g.smClient = &client{c}
+
+	if g.prefetchFilter != "" {
+		if err := g.Prefetch(ctx); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// NewFromClient returns an initialized GSManager that uses an existing secret manager client.
+// The client is closed when the GSManager is closed. Secrets are not prefetched, Prefetch
+// must be called explicitly when WithPrefetch is used.
+func NewFromClient(c *secretmanager.Client, options ...Option) *GSManager {
+	return newGSManager(&client{c}, options...)
+}
+
+func newGSManager(c secretManagerClient, options ...Option) *GSManager {
+	g := &GSManager{
+		smClient:            c,
+		defaultVersion:      defaultVersion,
+		detectProject:       detectProject,
+		prefetchConcurrency: defaultPrefetchConcurrency,
+	}
+	for _, option := range options {
+		option(g)
+	}
+
+	return g
+}
+
+// detectProject returns the project from the environment or the Application Default Credentials.
+func detectProject(ctx context.Context) (string, error) {
+	if p := os.Getenv(projectEnv); p != "" {
+		return p, nil
+	}
+
+	creds, err := google.FindDefaultCredentials(ctx, cloudPlatformScope)
+	if err != nil {
+		return "", err
+	}
+	if creds.ProjectID == "" {
+		return "", fmt.Errorf("application default credentials do not contain a project")
+	}
+
+	return creds.ProjectID, nil
 }
 
 // Decrypt will access the secret on GCP Secret Manager and return the plain text string.
 func (g *GSManager) Decrypt(ctx context.Context, secret string) (string, error) {
+	name, err := g.resourceName(ctx, secret)
+	if err != nil {
+		return "", fmt.Errorf("gsmanager: %w", err)
+	}
+
+	if v, ok := g.takePrefetched(name); ok {
+		return v, nil
+	}
+
+	v, err := g.access(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("gsmanager: %w", err)
+	}
+
+	return v, nil
+}
+
+// access accesses the secret version name and returns its verified payload.
+func (g *GSManager) access(ctx context.Context, name string) (string, error) {
 	req := &secretmanagerpb.AccessSecretVersionRequest{
-		Name: secret,
+		Name: name,
 	}
 
 	result, err := g.smClient.AccessSecretVersion(ctx, req)
 	if err != nil {
-		return "", fmt.Errorf("gsmanager: failed to access secret version: %w", err)
+		return "", fmt.Errorf("failed to access secret version: %w", err)
+	}
+
+	data, err := verifyPayload(name, result.GetPayload())
+	if err != nil {
+		return "", err
 	}
 
-	return string(result.Payload.Data), nil
+	return string(data), nil
+}
+
+// verifyPayload returns the payload's data after verifying its CRC32C checksum, if Secret
+// Manager returned one.
+func verifyPayload(name string, payload *secretmanagerpb.SecretPayload) ([]byte, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("secret version %s has no payload", name)
+	}
+
+	if payload.DataCrc32C == nil {
+		return payload.Data, nil
+	}
+
+	expected := uint32(*payload.DataCrc32C)
+	if actual := crc32.Checksum(payload.Data, crc32cTable); actual != expected {
+		return nil, &CorruptPayloadError{Name: name, Expected: expected, Actual: actual}
+	}
+
+	return payload.Data, nil
 }
 
 // Close closes the connection to the secret manager API.
 func (g *GSManager) Close() error {
 	return g.smClient.Close()
 }
+
+// resourceName expands a secret reference into the full resource name of a secret version.
+func (g *GSManager) resourceName(ctx context.Context, secret string) (string, error) {
+	if strings.HasPrefix(secret, resourcePrefix) {
+		parts := strings.Split(secret, "/")
+		// regional secrets include their location after the project
+		secretIdx := 2
+		if len(parts) > 2 && parts[2] == "locations" {
+			secretIdx = 4
+		}
+
+		switch {
+		case len(parts) == secretIdx+2 && parts[secretIdx] == "secrets":
+			return fmt.Sprintf("%s/versions/%s", secret, g.defaultVersion), nil
+		case len(parts) == secretIdx+4 && parts[secretIdx] == "secrets" && parts[secretIdx+2] == "versions":
+			return secret, nil
+		default:
+			return "", fmt.Errorf("invalid secret resource name %q", secret)
+		}
+	}
+
+	// any other path is passed through to Secret Manager as is
+	if strings.Contains(secret, "/") {
+		return secret, nil
+	}
+
+	name, version := secret, g.defaultVersion
+	if i := strings.LastIndex(secret, versionSeparator); i >= 0 {
+		name, version = secret[:i], secret[i+1:]
+	}
+	if name == "" || version == "" {
+		return "", fmt.Errorf("invalid secret reference %q, expected <name>[@<version>]", secret)
+	}
+
+	project, err := g.defaultProject(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand secret reference %q: %w", secret, err)
+	}
+
+	if g.location != "" {
+		project = fmt.Sprintf("%s/locations/%s", project, g.location)
+	}
+
+	return fmt.Sprintf("%s%s/secrets/%s/versions/%s", resourcePrefix, project, name, version), nil
+}
+
+func (g *GSManager) defaultProject(ctx context.Context) (string, error) {
+	g.projectOnce.Do(func() {
+		if g.project != "" {
+			return
+		}
+
+		p, err := g.detectProject(ctx)
+		if err != nil {
+			g.projectErr = fmt.Errorf("no default project set and detection failed: %w", err)
+			return
+		}
+		g.project = p
+	})
+
+	return g.project, g.projectErr
+}
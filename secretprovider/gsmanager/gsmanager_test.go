@@ -2,30 +2,134 @@ package gsmanager
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"gotest.tools/v3/assert"
 )
 
 type testClient struct {
 	accessSecretVersionCalled bool
+	accessSecretVersionReq    *secretmanagerpb.AccessSecretVersionRequest
 	accessSecretReturnError   error
 	accessSecretVersionReturn *secretmanagerpb.AccessSecretVersionResponse
 	closeCalled               bool
+
+	listSecretsReq    *secretmanagerpb.ListSecretsRequest
+	listSecretsReturn []*secretmanagerpb.Secret
+	listSecretsError  error
+	// versions are returned by AccessSecretVersion keyed by name when set
+	versions map[string]string
+	accessed []string
+	mu       sync.Mutex
+
+	// secrets contains the versions added to each secret, AddSecretVersion returns NotFound for
+	// secrets that are not in the map
+	secrets           map[string][]string
+	createSecretReq   *secretmanagerpb.CreateSecretRequest
+	createSecretError error
+	addVersionError   error
 }
 
 func (tc *testClient) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest,
 	opts ...gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
 	tc.accessSecretVersionCalled = true
+	tc.accessSecretVersionReq = req
+	tc.accessed = append(tc.accessed, req.Name)
 	if tc.accessSecretReturnError != nil {
 		return nil, tc.accessSecretReturnError
 	}
 
+	if tc.versions != nil {
+		v, ok := tc.versions[req.Name]
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Name)
+		}
+		return &secretmanagerpb.AccessSecretVersionResponse{
+			Name:    req.Name,
+			Payload: &secretmanagerpb.SecretPayload{Data: []byte(v)},
+		}, nil
+	}
+
 	return tc.accessSecretVersionReturn, nil
 }
 
+func (tc *testClient) ListSecrets(ctx context.Context, req *secretmanagerpb.ListSecretsRequest,
+	opts ...gax.CallOption) secretIterator {
+	tc.listSecretsReq = req
+	return &testIterator{secrets: tc.listSecretsReturn, err: tc.listSecretsError}
+}
+
+type testIterator struct {
+	secrets []*secretmanagerpb.Secret
+	err     error
+}
+
+func (ti *testIterator) Next() (*secretmanagerpb.Secret, error) {
+	if ti.err != nil {
+		return nil, ti.err
+	}
+	if len(ti.secrets) == 0 {
+		return nil, iterator.Done
+	}
+
+	s := ti.secrets[0]
+	ti.secrets = ti.secrets[1:]
+	return s, nil
+}
+
+func (tc *testClient) CreateSecret(ctx context.Context, req *secretmanagerpb.CreateSecretRequest,
+	opts ...gax.CallOption) (*secretmanagerpb.Secret, error) {
+	tc.createSecretReq = req
+	if tc.createSecretError != nil {
+		return nil, tc.createSecretError
+	}
+
+	name := req.Parent + "/secrets/" + req.SecretId
+	if _, ok := tc.secrets[name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "secret %s already exists", name)
+	}
+	tc.secrets[name] = nil
+	return &secretmanagerpb.Secret{Name: name}, nil
+}
+
+func (tc *testClient) AddSecretVersion(ctx context.Context, req *secretmanagerpb.AddSecretVersionRequest,
+	opts ...gax.CallOption) (*secretmanagerpb.SecretVersion, error) {
+	if tc.addVersionError != nil {
+		return nil, tc.addVersionError
+	}
+
+	versions, ok := tc.secrets[req.Parent]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Parent)
+	}
+	if req.Payload.DataCrc32C == nil || uint32(*req.Payload.DataCrc32C) != crc32.Checksum(req.Payload.Data, crc32cTable) {
+		return nil, status.Error(codes.InvalidArgument, "invalid checksum")
+	}
+
+	tc.secrets[req.Parent] = append(versions, string(req.Payload.Data))
+	return &secretmanagerpb.SecretVersion{
+		Name: fmt.Sprintf("%s/versions/%d", req.Parent, len(versions)+1),
+	}, nil
+}
+
 func (tc *testClient) Close() error {
 	tc.closeCalled = true
 	return nil
@@ -62,3 +166,629 @@ func TestClose(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Equal(t, tc.closeCalled, true)
 }
+
+func TestDecryptReferences(t *testing.T) {
+	tt := []struct {
+		name          string
+		options       []Option
+		detectProject func(ctx context.Context) (string, error)
+		secret        string
+		expectedName  string
+		expectedErr   error
+	}{
+		{
+			name:         "full resource name",
+			secret:       "projects/p/secrets/db-password/versions/3",
+			expectedName: "projects/p/secrets/db-password/versions/3",
+		},
+		{
+			name:         "full resource name without version",
+			secret:       "projects/p/secrets/db-password",
+			expectedName: "projects/p/secrets/db-password/versions/latest",
+		},
+		{
+			name:         "regional resource name",
+			secret:       "projects/p/locations/us-east1/secrets/db-password/versions/3",
+			expectedName: "projects/p/locations/us-east1/secrets/db-password/versions/3",
+		},
+		{
+			name:         "regional resource name without version",
+			secret:       "projects/p/locations/us-east1/secrets/db-password",
+			expectedName: "projects/p/locations/us-east1/secrets/db-password/versions/latest",
+		},
+		{
+			name:         "other path",
+			secret:       "my/super/secret/versions/latest",
+			expectedName: "my/super/secret/versions/latest",
+		},
+		{
+			name:         "short reference with project",
+			options:      []Option{WithProject("my-project")},
+			secret:       "db-password",
+			expectedName: "projects/my-project/secrets/db-password/versions/latest",
+		},
+		{
+			name:         "short reference with version",
+			options:      []Option{WithProject("my-project")},
+			secret:       "db-password@3",
+			expectedName: "projects/my-project/secrets/db-password/versions/3",
+		},
+		{
+			name:         "short reference with default version",
+			options:      []Option{WithProject("my-project"), WithDefaultVersion("1")},
+			secret:       "db-password",
+			expectedName: "projects/my-project/secrets/db-password/versions/1",
+		},
+		{
+			name: "short reference with detected project",
+			detectProject: func(ctx context.Context) (string, error) {
+				return "detected", nil
+			},
+			secret:       "db-password",
+			expectedName: "projects/detected/secrets/db-password/versions/latest",
+		},
+		{
+			name: "short reference with failed detection",
+			detectProject: func(ctx context.Context) (string, error) {
+				return "", errors.New("could not find default credentials")
+			},
+			secret:      "db-password",
+			expectedErr: errors.New("no default project set and detection failed: could not find default credentials"),
+		},
+		{
+			name:         "regional resource name",
+			secret:       "projects/p/locations/europe-west1/secrets/db-password/versions/2",
+			expectedName: "projects/p/locations/europe-west1/secrets/db-password/versions/2",
+		},
+		{
+			name:         "regional resource name without version",
+			secret:       "projects/p/locations/europe-west1/secrets/db-password",
+			expectedName: "projects/p/locations/europe-west1/secrets/db-password/versions/latest",
+		},
+		{
+			name:         "short reference with region",
+			options:      []Option{WithProject("my-project"), WithRegion("europe-west1")},
+			secret:       "db-password@2",
+			expectedName: "projects/my-project/locations/europe-west1/secrets/db-password/versions/2",
+		},
+		{
+			name:        "invalid resource name",
+			secret:      "projects/p/secrets",
+			expectedErr: errors.New("invalid secret resource name"),
+		},
+		{
+			name:        "invalid short reference",
+			options:     []Option{WithProject("my-project")},
+			secret:      "db-password@",
+			expectedErr: errors.New("invalid secret reference"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &testClient{
+				accessSecretVersionReturn: &secretmanagerpb.AccessSecretVersionResponse{
+					Payload: &secretmanagerpb.SecretPayload{Data: []byte("superSecret")},
+				},
+			}
+			gsm := newGSManager(client, tc.options...)
+			gsm.detectProject = func(ctx context.Context) (string, error) {
+				t.Fatal("project detection should not be called")
+				return "", nil
+			}
+			if tc.detectProject != nil {
+				gsm.detectProject = tc.detectProject
+			}
+
+			dec, err := gsm.Decrypt(context.Background(), tc.secret)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				assert.Equal(t, client.accessSecretVersionCalled, false)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, dec, "superSecret")
+			assert.Equal(t, client.accessSecretVersionReq.Name, tc.expectedName)
+		})
+	}
+}
+
+func TestDecryptChecksum(t *testing.T) {
+	name := "projects/p/secrets/db-password/versions/1"
+	data := []byte("superSecret")
+	checksum := int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	badChecksum := checksum + 1
+
+	tt := []struct {
+		name          string
+		response      *secretmanagerpb.AccessSecretVersionResponse
+		expected      string
+		expectCorrupt bool
+		expectedErr   error
+	}{
+		{
+			name: "valid checksum",
+			response: &secretmanagerpb.AccessSecretVersionResponse{
+				Payload: &secretmanagerpb.SecretPayload{Data: data, DataCrc32C: &checksum},
+			},
+			expected: "superSecret",
+		},
+		{
+			name: "no checksum",
+			response: &secretmanagerpb.AccessSecretVersionResponse{
+				Payload: &secretmanagerpb.SecretPayload{Data: data},
+			},
+			expected: "superSecret",
+		},
+		{
+			name: "checksum mismatch",
+			response: &secretmanagerpb.AccessSecretVersionResponse{
+				Payload: &secretmanagerpb.SecretPayload{Data: data, DataCrc32C: &badChecksum},
+			},
+			expectCorrupt: true,
+			expectedErr:   errors.New("payload of " + name + " is corrupt"),
+		},
+		{
+			name:        "nil payload",
+			response:    &secretmanagerpb.AccessSecretVersionResponse{},
+			expectedErr: errors.New("has no payload"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			gsm := newGSManager(&testClient{accessSecretVersionReturn: tc.response})
+
+			dec, err := gsm.Decrypt(context.Background(), name)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				var corrupt *CorruptPayloadError
+				assert.Equal(t, errors.As(err, &corrupt), tc.expectCorrupt)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, dec, tc.expected)
+		})
+	}
+}
+
+// fakeServer is an in-process Secret Manager gRPC server.
+type fakeServer struct {
+	secretmanagerpb.UnimplementedSecretManagerServiceServer
+	secrets map[string]string
+	list    []*secretmanagerpb.Secret
+
+	mu       sync.Mutex
+	accessed []string
+}
+
+func (f *fakeServer) AccessSecretVersion(ctx context.Context,
+	req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	f.mu.Lock()
+	f.accessed = append(f.accessed, req.Name)
+	f.mu.Unlock()
+
+	v, ok := f.secrets[req.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Name)
+	}
+
+	return &secretmanagerpb.AccessSecretVersionResponse{
+		Name:    req.Name,
+		Payload: &secretmanagerpb.SecretPayload{Data: []byte(v)},
+	}, nil
+}
+
+// ListSecrets lists the secrets of the parent matching a labels.<key>=<value> or name:<prefix> filter.
+func (f *fakeServer) ListSecrets(ctx context.Context,
+	req *secretmanagerpb.ListSecretsRequest) (*secretmanagerpb.ListSecretsResponse, error) {
+	resp := &secretmanagerpb.ListSecretsResponse{}
+	for _, s := range f.list {
+		if !strings.HasPrefix(s.Name, req.Parent+"/secrets/") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(req.Filter, "labels."):
+			kv := strings.SplitN(strings.TrimPrefix(req.Filter, "labels."), "=", 2)
+			if len(kv) != 2 || s.Labels[kv[0]] != kv[1] {
+				continue
+			}
+		case strings.HasPrefix(req.Filter, "name:"):
+			if !strings.HasPrefix(s.Name[strings.LastIndex(s.Name, "/")+1:], strings.TrimPrefix(req.Filter, "name:")) {
+				continue
+			}
+		}
+		resp.Secrets = append(resp.Secrets, s)
+	}
+
+	return resp, nil
+}
+
+func startFakeServer(t *testing.T) (string, *fakeServer) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	fake := &fakeServer{
+		secrets: map[string]string{
+			"projects/p/secrets/db-password/versions/latest": "superSecret",
+			"projects/p/secrets/db-user/versions/latest":     "admin",
+			"projects/p/secrets/api-key/versions/latest":     "key",
+		},
+		list: []*secretmanagerpb.Secret{
+			{Name: "projects/p/secrets/db-password", Labels: map[string]string{"team": "payments"}},
+			{Name: "projects/p/secrets/db-user", Labels: map[string]string{"team": "payments"}},
+			{Name: "projects/p/secrets/api-key", Labels: map[string]string{"team": "search"}},
+		},
+	}
+
+	srv := grpc.NewServer()
+	secretmanagerpb.RegisterSecretManagerServiceServer(srv, fake)
+	go srv.Serve(lis) //nolint:errcheck
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String(), fake
+}
+
+func TestNewWithEmulator(t *testing.T) {
+	addr, _ := startFakeServer(t)
+
+	gsm, err := New(context.Background(), WithEmulator(addr), WithProject("p"))
+	assert.NilError(t, err)
+	defer gsm.Close()
+
+	dec, err := gsm.Decrypt(context.Background(), "db-password")
+	assert.NilError(t, err)
+	assert.Equal(t, dec, "superSecret")
+
+	_, err = gsm.Decrypt(context.Background(), "missing")
+	assert.ErrorContains(t, err, "NotFound")
+}
+
+func TestNewFromClient(t *testing.T) {
+	addr, _ := startFakeServer(t)
+
+	c, err := secretmanager.NewClient(context.Background(),
+		option.WithEndpoint(addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+	)
+	assert.NilError(t, err)
+
+	gsm := NewFromClient(c)
+	dec, err := gsm.Decrypt(context.Background(), "projects/p/secrets/db-password")
+	assert.NilError(t, err)
+	assert.Equal(t, dec, "superSecret")
+	assert.NilError(t, gsm.Close())
+}
+
+func TestClientOptions(t *testing.T) {
+	gsm := newGSManager(nil,
+		WithClientOptions(option.WithCredentialsFile("creds.json")),
+		WithRegion("us-east1"),
+	)
+
+	assert.Equal(t, len(gsm.clientOptions), 2)
+	assert.Equal(t, gsm.location, "us-east1")
+}
+
+func TestPrefetch(t *testing.T) {
+	tt := []struct {
+		name           string
+		options        []Option
+		list           []*secretmanagerpb.Secret
+		listErr        error
+		versions       map[string]string
+		expectedParent string
+		expected       map[string]string
+		expectedErr    error
+	}{
+		{
+			name:    "prefetch latest versions",
+			options: []Option{WithProject("p"), WithPrefetch("labels.team=payments")},
+			list: []*secretmanagerpb.Secret{
+				{Name: "projects/p/secrets/db-password"},
+				{Name: "projects/p/secrets/db-user"},
+			},
+			versions: map[string]string{
+				"projects/p/secrets/db-password/versions/latest": "superSecret",
+				"projects/p/secrets/db-user/versions/latest":     "admin",
+			},
+			expectedParent: "projects/p",
+			expected: map[string]string{
+				"secrets/db-password/versions/latest": "superSecret",
+				"secrets/db-user/versions/latest":     "admin",
+			},
+		},
+		{
+			name:    "prefetch default version in region",
+			options: []Option{WithProject("p"), WithRegion("europe-west1"), WithDefaultVersion("2"), WithPrefetch("name:db-")},
+			list: []*secretmanagerpb.Secret{
+				{Name: "projects/p/locations/europe-west1/secrets/db-password"},
+			},
+			versions: map[string]string{
+				"projects/p/locations/europe-west1/secrets/db-password/versions/2": "superSecret",
+			},
+			expectedParent: "projects/p/locations/europe-west1",
+			expected: map[string]string{
+				"locations/europe-west1/secrets/db-password/versions/2": "superSecret",
+			},
+		},
+		{
+			name:    "skip inaccessible secrets",
+			options: []Option{WithProject("p"), WithPrefetch("name:db-"), WithPrefetchConcurrency(1)},
+			list: []*secretmanagerpb.Secret{
+				{Name: "projects/p/secrets/db-password"},
+				{Name: "projects/p/secrets/db-disabled"},
+			},
+			versions: map[string]string{
+				"projects/p/secrets/db-password/versions/latest": "superSecret",
+			},
+			expectedParent: "projects/p",
+			expected: map[string]string{
+				"secrets/db-password/versions/latest": "superSecret",
+			},
+		},
+		{
+			name:        "list error",
+			options:     []Option{WithProject("p"), WithPrefetch("name:db-")},
+			listErr:     errors.New("permission denied"),
+			expectedErr: errors.New("gsmanager: failed to list secrets: permission denied"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &testClient{
+				listSecretsReturn: tc.list,
+				listSecretsError:  tc.listErr,
+				versions:          tc.versions,
+			}
+			gsm := newGSManager(client, tc.options...)
+
+			err := gsm.Prefetch(context.Background())
+			if tc.expectedErr != nil {
+				assert.Error(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, client.listSecretsReq.Parent, tc.expectedParent)
+			assert.DeepEqual(t, gsm.prefetched, tc.expected)
+		})
+	}
+}
+
+func TestDecryptPrefetched(t *testing.T) {
+	client := &testClient{
+		listSecretsReturn: []*secretmanagerpb.Secret{
+			{Name: "projects/p/secrets/db-password"},
+		},
+		versions: map[string]string{
+			"projects/p/secrets/db-password/versions/latest": "superSecret",
+			"projects/p/secrets/api-key/versions/latest":     "key",
+		},
+	}
+	gsm := newGSManager(client, WithProject("p"), WithPrefetch("name:db-"))
+	assert.NilError(t, gsm.Prefetch(context.Background()))
+	client.accessed = nil
+
+	dec, err := gsm.Decrypt(context.Background(), "db-password")
+	assert.NilError(t, err)
+	assert.Equal(t, dec, "superSecret")
+	assert.Equal(t, len(client.accessed), 0)
+
+	// secrets that were not prefetched fall back to a live call
+	dec, err = gsm.Decrypt(context.Background(), "api-key")
+	assert.NilError(t, err)
+	assert.Equal(t, dec, "key")
+	assert.DeepEqual(t, client.accessed, []string{"projects/p/secrets/api-key/versions/latest"})
+
+	// prefetched values are only served once so rotated versions are seen
+	client.versions["projects/p/secrets/db-password/versions/latest"] = "rotated"
+	dec, err = gsm.Decrypt(context.Background(), "db-password")
+	assert.NilError(t, err)
+	assert.Equal(t, dec, "rotated")
+}
+
+func TestDecryptPrefetchedProjectNumber(t *testing.T) {
+	// secrets are listed with the project number while references use the project ID
+	client := &testClient{
+		listSecretsReturn: []*secretmanagerpb.Secret{
+			{Name: "projects/123456/secrets/db-password"},
+			{Name: "projects/123456/secrets/db-user"},
+		},
+		versions: map[string]string{
+			"projects/123456/secrets/db-password/versions/latest": "superSecret",
+			"projects/123456/secrets/db-user/versions/latest":     "admin",
+		},
+	}
+	gsm := newGSManager(client, WithProject("my-project"), WithPrefetch("name:db-"))
+	assert.NilError(t, gsm.Prefetch(context.Background()))
+	client.accessed = nil
+
+	dec, err := gsm.Decrypt(context.Background(), "db-password")
+	assert.NilError(t, err)
+	assert.Equal(t, dec, "superSecret")
+
+	dec, err = gsm.Decrypt(context.Background(), "projects/123456/secrets/db-user")
+	assert.NilError(t, err)
+	assert.Equal(t, dec, "admin")
+	assert.Equal(t, len(client.accessed), 0)
+
+	// secrets of other projects are not served from the cache
+	_, err = gsm.Decrypt(context.Background(), "projects/other/secrets/db-user")
+	assert.ErrorContains(t, err, "NotFound")
+}
+
+func TestNewWithPrefetch(t *testing.T) {
+	addr, fake := startFakeServer(t)
+
+	gsm, err := New(context.Background(), WithEmulator(addr), WithProject("p"), WithPrefetch("labels.team=payments"))
+	assert.NilError(t, err)
+	defer gsm.Close()
+
+	sort.Strings(fake.accessed)
+	assert.DeepEqual(t, fake.accessed, []string{
+		"projects/p/secrets/db-password/versions/latest",
+		"projects/p/secrets/db-user/versions/latest",
+	})
+
+	dec, err := gsm.Decrypt(context.Background(), "db-user")
+	assert.NilError(t, err)
+	assert.Equal(t, dec, "admin")
+	assert.Equal(t, len(fake.accessed), 2)
+}
+
+func TestAddVersion(t *testing.T) {
+	tt := []struct {
+		name            string
+		options         []Option
+		secrets         map[string][]string
+		secret          string
+		expectedVersion string
+		expectedCreate  *secretmanagerpb.CreateSecretRequest
+	}{
+		{
+			name:            "existing secret",
+			secrets:         map[string][]string{"projects/p/secrets/db-password": {"old"}},
+			secret:          "projects/p/secrets/db-password",
+			expectedVersion: "projects/p/secrets/db-password/versions/2",
+		},
+		{
+			name:            "new secret",
+			options:         []Option{WithProject("p")},
+			secrets:         map[string][]string{},
+			secret:          "db-password",
+			expectedVersion: "projects/p/secrets/db-password/versions/1",
+			expectedCreate: &secretmanagerpb.CreateSecretRequest{
+				Parent:   "projects/p",
+				SecretId: "db-password",
+				Secret: &secretmanagerpb.Secret{
+					Replication: &secretmanagerpb.Replication{
+						Replication: &secretmanagerpb.Replication_Automatic_{
+							Automatic: &secretmanagerpb.Replication_Automatic{},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:            "new regional secret",
+			options:         []Option{WithProject("p"), WithRegion("europe-west1")},
+			secrets:         map[string][]string{},
+			secret:          "db-password",
+			expectedVersion: "projects/p/locations/europe-west1/secrets/db-password/versions/1",
+			expectedCreate: &secretmanagerpb.CreateSecretRequest{
+				Parent:   "projects/p/locations/europe-west1",
+				SecretId: "db-password",
+				Secret:   &secretmanagerpb.Secret{},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &testClient{secrets: tc.secrets}
+			gsm := newGSManager(client, tc.options...)
+
+			version, err := gsm.AddVersion(context.Background(), tc.secret, []byte("hunter2"))
+			assert.NilError(t, err)
+			assert.Equal(t, version, tc.expectedVersion)
+
+			versions := client.secrets[version[:strings.LastIndex(version, "/versions/")]]
+			assert.Equal(t, versions[len(versions)-1], "hunter2")
+
+			if tc.expectedCreate == nil {
+				assert.Assert(t, client.createSecretReq == nil)
+				return
+			}
+			assert.Assert(t, client.createSecretReq != nil)
+			assert.Equal(t, client.createSecretReq.String(), tc.expectedCreate.String())
+		})
+	}
+}
+
+func TestAddVersionError(t *testing.T) {
+	tt := []struct {
+		name        string
+		client      *testClient
+		secret      string
+		expectedErr string
+	}{
+		{
+			name:        "version in short reference",
+			client:      &testClient{},
+			secret:      "db-password@3",
+			expectedErr: `secret reference "db-password@3" must not include a version`,
+		},
+		{
+			name:        "version in resource name",
+			client:      &testClient{},
+			secret:      "projects/p/secrets/db-password/versions/3",
+			expectedErr: "must not include a version",
+		},
+		{
+			name:        "invalid resource name",
+			client:      &testClient{},
+			secret:      "projects/p/secrets",
+			expectedErr: "invalid secret resource name",
+		},
+		{
+			name:        "path reference",
+			client:      &testClient{},
+			secret:      "team/db-password",
+			expectedErr: `gsmanager: invalid secret reference "team/db-password", expected <name> or projects/`,
+		},
+		{
+			name: "create error",
+			client: &testClient{
+				secrets:           map[string][]string{},
+				createSecretError: status.Error(codes.PermissionDenied, "denied"),
+			},
+			secret:      "projects/p/secrets/db-password",
+			expectedErr: "gsmanager: failed to create secret",
+		},
+		{
+			name:        "add version error",
+			client:      &testClient{addVersionError: status.Error(codes.PermissionDenied, "denied")},
+			secret:      "projects/p/secrets/db-password",
+			expectedErr: "gsmanager: failed to add secret version",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			gsm := newGSManager(tc.client, WithProject("p"))
+
+			_, err := gsm.AddVersion(context.Background(), tc.secret, []byte("hunter2"))
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestAddVersionCreatedConcurrently(t *testing.T) {
+	// the secret is created between AddSecretVersion and CreateSecret
+	client := &testClient{secrets: map[string][]string{}}
+	gsm := newGSManager(&racingClient{testClient: client}, WithProject("p"))
+
+	version, err := gsm.AddVersion(context.Background(), "db-password", []byte("hunter2"))
+	assert.NilError(t, err)
+	assert.Equal(t, version, "projects/p/secrets/db-password/versions/1")
+}
+
+// racingClient creates the secret when the first version is added to a missing secret.
+type racingClient struct {
+	*testClient
+}
+
+func (rc *racingClient) AddSecretVersion(ctx context.Context, req *secretmanagerpb.AddSecretVersionRequest,
+	opts ...gax.CallOption) (*secretmanagerpb.SecretVersion, error) {
+	v, err := rc.testClient.AddSecretVersion(ctx, req, opts...)
+	if _, ok := rc.secrets[req.Parent]; !ok {
+		rc.secrets[req.Parent] = nil
+	}
+	return v, err
+}
@@ -0,0 +1,144 @@
+package gsmanager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/iterator"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+const defaultPrefetchConcurrency = 8
+
+// WithPrefetch lists the secrets of the default project matching filter when the GSManager is
+// created and accesses their default version concurrently. Decrypt serves each prefetched secret
+// from memory once, so later decrypts, e.g. by Injector.Watch, see rotated versions, and falls back
+// to accessing Secret Manager for anything that was not prefetched.
+// The filter uses the Secret Manager list filter syntax, e.g. labels.team=payments to match a
+// label or name:db- to match a name prefix.
+func WithPrefetch(filter string) Option {
+	return func(g *GSManager) {
+		g.prefetchFilter = filter
+	}
+}
+
+// WithPrefetchConcurrency sets the maximum number of secrets accessed concurrently while
+// prefetching. It defaults to 8.
+func WithPrefetchConcurrency(n int) Option {
+	return func(g *GSManager) {
+		if n > 0 {
+			g.prefetchConcurrency = n
+		}
+	}
+}
+
+// Prefetch lists the secrets matching the filter set using WithPrefetch and loads their default
+// version into memory, replacing anything prefetched before. Secrets whose version can not be
+// accessed are skipped and will be accessed again when they are decrypted.
+func (g *GSManager) Prefetch(ctx context.Context) error {
+	project, err := g.defaultProject(ctx)
+	if err != nil {
+		return fmt.Errorf("gsmanager: failed to prefetch secrets: %w", err)
+	}
+
+	parent := resourcePrefix + project
+	if g.location != "" {
+		parent = fmt.Sprintf("%s/locations/%s", parent, g.location)
+	}
+
+	var names []string
+	it := g.smClient.ListSecrets(ctx, &secretmanagerpb.ListSecretsRequest{
+		Parent: parent,
+		Filter: g.prefetchFilter,
+	})
+	for {
+		secret, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("gsmanager: failed to list secrets: %w", err)
+		}
+
+		names = append(names, fmt.Sprintf("%s/versions/%s", secret.Name, g.defaultVersion))
+	}
+
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		prefetched = make(map[string]string, len(names))
+		projects   = map[string]bool{project: true}
+		sem        = make(chan struct{}, g.prefetchConcurrency)
+	)
+	for _, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			v, err := g.access(ctx, name)
+			if err != nil {
+				return
+			}
+
+			// listed secrets are named after the project number while references use the
+			// project ID, so the cache is keyed by the name without its project
+			p, key, ok := splitProject(name)
+			if !ok {
+				return
+			}
+
+			mu.Lock()
+			prefetched[key] = v
+			projects[p] = true
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	g.prefetchMu.Lock()
+	g.prefetched = prefetched
+	g.prefetchProjects = projects
+	g.prefetchMu.Unlock()
+	return nil
+}
+
+// takePrefetched returns the prefetched value of the secret version name and removes it
+// from the cache.
+func (g *GSManager) takePrefetched(name string) (string, bool) {
+	project, key, ok := splitProject(name)
+	if !ok {
+		return "", false
+	}
+
+	g.prefetchMu.Lock()
+	defer g.prefetchMu.Unlock()
+
+	if !g.prefetchProjects[project] {
+		return "", false
+	}
+	v, ok := g.prefetched[key]
+	if ok {
+		delete(g.prefetched, key)
+	}
+
+	return v, ok
+}
+
+// splitProject splits a resource name into its project and the rest of the name,
+// e.g. secrets/<name>/versions/<version>.
+func splitProject(name string) (project, rest string, ok bool) {
+	if !strings.HasPrefix(name, resourcePrefix) {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(name, resourcePrefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
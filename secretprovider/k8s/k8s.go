@@ -0,0 +1,158 @@
+// Package k8s contains the secretprovider implementation for
+// Kubernetes Secrets read through the API server.
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// RefPrefix is the prefix of secret references resolved by the Kubernetes provider.
+	RefPrefix       = "k8s://"
+	keySeparator    = "#"
+	defaultCacheTTL = 30 * time.Second
+)
+
+// now is used to get the current time, it is replaced in tests.
+var now = time.Now
+
+// Option represents a function that can be passed into New or NewWithClient to modify
+// the behavior of the Kubernetes provider.
+type Option func(k *Kubernetes)
+
+// WithCacheTTL sets how long a Secret read from the API server is kept in memory, so that
+// its keys are resolved with a single request. It defaults to 30 seconds, 0 disables caching.
+func WithCacheTTL(d time.Duration) Option {
+	return func(k *Kubernetes) {
+		k.cacheTTL = d
+	}
+}
+
+// Kubernetes is a secret provider that reads secrets from Kubernetes Secrets. Secrets are
+// referenced as k8s://<namespace>/<secret>#<key>.
+type Kubernetes struct {
+	client   kubernetes.Interface
+	cacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*cachedSecret
+}
+
+type cachedSecret struct {
+	data    map[string][]byte
+	expires time.Time
+}
+
+// New returns an initialized Kubernetes provider using an in-cluster client.
+func New(options ...Option) (*Kubernetes, error) {
+	c, err := NewInClusterClient()
+	if err != nil {
+		return nil, fmt.Errorf("k8s: failed to initialize client: %w", err)
+	}
+
+	return NewWithClient(c, options...), nil
+}
+
+// NewWithClient returns a Kubernetes provider that uses the provided client.
+func NewWithClient(c kubernetes.Interface, options ...Option) *Kubernetes {
+	k := &Kubernetes{
+		client:   c,
+		cacheTTL: defaultCacheTTL,
+		cache:    make(map[string]*cachedSecret),
+	}
+	for _, option := range options {
+		option(k)
+	}
+
+	return k
+}
+
+// Decrypt will read the key of the referenced Kubernetes Secret and return the plain text string.
+func (k *Kubernetes) Decrypt(ctx context.Context, secret string) (string, error) {
+	namespace, name, key, err := ParseRef(secret)
+	if err != nil {
+		return "", fmt.Errorf("k8s: %w", err)
+	}
+
+	data, err := k.secretData(ctx, namespace, name)
+	if err != nil {
+		return "", fmt.Errorf("k8s: %w", err)
+	}
+
+	v, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("k8s: key %q not found in secret %s/%s", key, namespace, name)
+	}
+
+	return string(v), nil
+}
+
+// secretData returns the data of the Secret namespace/name, from the cache when it was read
+// less than the cache TTL ago.
+func (k *Kubernetes) secretData(ctx context.Context, namespace, name string) (map[string][]byte, error) {
+	id := namespace + "/" + name
+
+	k.mu.Lock()
+	c, ok := k.cache[id]
+	k.mu.Unlock()
+	if ok && now().Before(c.expires) {
+		return c.data, nil
+	}
+
+	s, err := k.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	k.store(namespace, name, s.Data)
+	return s.Data, nil
+}
+
+// store caches the data of the Secret namespace/name, unless caching is disabled.
+func (k *Kubernetes) store(namespace, name string, data map[string][]byte) {
+	if k.cacheTTL <= 0 {
+		return
+	}
+
+	k.mu.Lock()
+	k.cache[namespace+"/"+name] = &cachedSecret{data: data, expires: now().Add(k.cacheTTL)}
+	k.mu.Unlock()
+}
+
+// Close is a no-op, the provider does not hold any open connections.
+func (k *Kubernetes) Close() error {
+	return nil
+}
+
+// Ref returns the secret reference for key in the Secret namespace/name.
+func Ref(namespace, name, key string) string {
+	return fmt.Sprintf("%s%s/%s%s%s", RefPrefix, namespace, name, keySeparator, key)
+}
+
+// ParseRef parses a secret reference in the form k8s://<namespace>/<secret>#<key>.
+func ParseRef(ref string) (namespace, name, key string, err error) {
+	if !strings.HasPrefix(ref, RefPrefix) {
+		return "", "", "", fmt.Errorf("invalid secret reference %q: missing %q prefix", ref, RefPrefix)
+	}
+
+	rest := strings.TrimPrefix(ref, RefPrefix)
+	i := strings.Index(rest, keySeparator)
+	if i < 0 {
+		return "", "", "", fmt.Errorf("invalid secret reference %q: missing key", ref)
+	}
+	path, key := rest[:i], rest[i+1:]
+
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || key == "" {
+		return "", "", "", fmt.Errorf("invalid secret reference %q, expected %s<namespace>/<secret>#<key>", ref, RefPrefix)
+	}
+
+	return parts[0], parts[1], key, nil
+}
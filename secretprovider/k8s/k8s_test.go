@@ -0,0 +1,252 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/wingocard/serum"
+	"github.com/wingocard/serum/secretprovider"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func secret(namespace, name string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       data,
+	}
+}
+
+func configMap(namespace, name string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       data,
+	}
+}
+
+// countGets returns a pointer to the number of Secret GETs made through client.
+func countGets(client *fake.Clientset) *int {
+	gets := 0
+	client.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return false, nil, nil
+	})
+	return &gets
+}
+
+func TestDecrypt(t *testing.T) {
+	k := NewWithClient(fake.NewSimpleClientset(
+		secret("prod", "db", map[string][]byte{"password": []byte("hunter2")}),
+	))
+
+	tt := []struct {
+		name        string
+		secret      string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "success",
+			secret:   "k8s://prod/db#password",
+			expected: "hunter2",
+		},
+		{
+			name:        "missing key",
+			secret:      "k8s://prod/db#user",
+			expectedErr: errors.New(`key "user" not found in secret prod/db`),
+		},
+		{
+			name:        "missing secret",
+			secret:      "k8s://prod/cache#password",
+			expectedErr: errors.New(`secrets "cache" not found`),
+		},
+		{
+			name:        "invalid reference",
+			secret:      "prod/db#password",
+			expectedErr: errors.New("missing \"k8s://\" prefix"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dec, err := k.Decrypt(context.Background(), tc.secret)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, dec, tc.expected)
+		})
+	}
+}
+
+func TestDecryptCache(t *testing.T) {
+	defer func() { now = time.Now }()
+	current := time.Now()
+	now = func() time.Time { return current }
+
+	client := fake.NewSimpleClientset(
+		secret("prod", "db", map[string][]byte{"user": []byte("app"), "password": []byte("hunter2")}),
+	)
+	gets := countGets(client)
+	k := NewWithClient(client, WithCacheTTL(time.Minute))
+
+	for _, ref := range []string{"k8s://prod/db#user", "k8s://prod/db#password"} {
+		_, err := k.Decrypt(context.Background(), ref)
+		assert.NilError(t, err)
+	}
+	assert.Equal(t, *gets, 1)
+
+	// the secret is read again once the cached copy expires
+	_, err := client.CoreV1().Secrets("prod").Update(context.Background(),
+		secret("prod", "db", map[string][]byte{"user": []byte("app"), "password": []byte("rotated")}),
+		metav1.UpdateOptions{})
+	assert.NilError(t, err)
+
+	current = current.Add(time.Minute)
+	dec, err := k.Decrypt(context.Background(), "k8s://prod/db#password")
+	assert.NilError(t, err)
+	assert.Equal(t, dec, "rotated")
+	assert.Equal(t, *gets, 2)
+
+	// caching can be disabled
+	k = NewWithClient(client, WithCacheTTL(0))
+	for i := 0; i < 2; i++ {
+		_, err := k.Decrypt(context.Background(), "k8s://prod/db#user")
+		assert.NilError(t, err)
+	}
+	assert.Equal(t, *gets, 4)
+}
+
+func TestParseRef(t *testing.T) {
+	ns, name, key, err := ParseRef(Ref("prod", "db", "password"))
+	assert.NilError(t, err)
+	assert.Equal(t, ns, "prod")
+	assert.Equal(t, name, "db")
+	assert.Equal(t, key, "password")
+
+	for _, ref := range []string{
+		"k8s://prod/db",
+		"k8s://db#password",
+		"k8s://prod/db/extra#password",
+		"k8s:///db#password",
+		"k8s://prod/db#",
+	} {
+		_, _, _, err := ParseRef(ref)
+		assert.ErrorContains(t, err, "invalid secret reference", ref)
+	}
+}
+
+func TestFromCluster(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		configMap("prod", "base", map[string]string{"LOG_LEVEL": "info", "DB_HOST": "db", "DB_PASSWORD": "overridden"}),
+		configMap("prod", "override", map[string]string{"LOG_LEVEL": "debug"}),
+		configMap("prod", "invalid", map[string]string{"log.level": "debug"}),
+		secret("prod", "db", map[string][]byte{"DB_PASSWORD": []byte("hunter2")}),
+		secret("prod", "tls", map[string][]byte{"tls.crt": []byte("cert")}),
+	)
+
+	tt := []struct {
+		name        string
+		configMaps  []string
+		secrets     []string
+		expectedEnv map[string]string
+		expectedErr string
+	}{
+		{
+			name:       "configmaps and secrets",
+			configMaps: []string{"base", "override"},
+			secrets:    []string{"db"},
+			expectedEnv: map[string]string{
+				"LOG_LEVEL":   "debug",
+				"DB_HOST":     "db",
+				"DB_PASSWORD": "hunter2",
+			},
+		},
+		{
+			name:        "missing configmap",
+			configMaps:  []string{"missing"},
+			expectedErr: `error loading env vars from configmap missing: configmaps "missing" not found`,
+		},
+		{
+			name:        "missing secret",
+			secrets:     []string{"missing"},
+			expectedErr: `error loading env vars from secret missing: secrets "missing" not found`,
+		},
+		{
+			name:        "invalid configmap key",
+			configMaps:  []string{"invalid"},
+			expectedErr: `error loading env vars from configmap invalid: invalid env var name "log.level"`,
+		},
+		{
+			name:        "invalid secret key",
+			secrets:     []string{"tls"},
+			expectedErr: `error loading env vars from secret tls: invalid env var name "tls.crt"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			k := NewWithClient(client)
+			ij, err := serum.NewInjector(
+				k.FromCluster(context.Background(), "prod", tc.configMaps, tc.secrets),
+				serum.WithSecretProviderFunc(func() (secretprovider.SecretProvider, error) {
+					return k, nil
+				}),
+			)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+
+			assert.NilError(t, ij.Inject(context.Background()))
+			for k, v := range tc.expectedEnv {
+				assert.Equal(t, os.Getenv(k), v)
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestFromClusterCache(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		secret("prod", "db", map[string][]byte{"DB_USER": []byte("app"), "DB_PASSWORD": []byte("hunter2")}),
+	)
+	gets := countGets(client)
+	k := NewWithClient(client)
+
+	ij, err := serum.NewInjector(
+		k.FromCluster(context.Background(), "prod", nil, []string{"db"}),
+		serum.WithSecretProviderFunc(func() (secretprovider.SecretProvider, error) {
+			return k, nil
+		}),
+	)
+	assert.NilError(t, err)
+
+	// the Secret read by the loader is not read again to resolve its keys
+	assert.NilError(t, ij.Inject(context.Background()))
+	defer os.Unsetenv("DB_USER")
+	defer os.Unsetenv("DB_PASSWORD")
+	assert.Equal(t, os.Getenv("DB_USER"), "app")
+	assert.Equal(t, os.Getenv("DB_PASSWORD"), "hunter2")
+	assert.Equal(t, *gets, 1)
+}
+
+func TestNewInClusterClientOutsideCluster(t *testing.T) {
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	defer os.Setenv("KUBERNETES_SERVICE_HOST", host)
+
+	c, err := NewInClusterClient()
+	assert.Assert(t, c == nil)
+	assert.ErrorContains(t, err, "unable to load in-cluster configuration")
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/wingocard/serum"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FromCluster returns a loader that will read the named ConfigMaps and Secrets in namespace
+// through the provider's client and assign them to an Injector. ConfigMap entries are loaded as
+// plain text variables, unless their value is in the form !{...}. Secret entries are loaded as
+// secrets referencing the Secret key, k8s://<namespace>/<secret>#<key>, which are resolved by
+// the provider on Inject. The Secrets read by the loader are cached like the ones read by
+// Decrypt, so they are not read again when the Injector uses k as its SecretProvider. When a key
+// is found in more than one source, the last one read wins, with Secrets read after ConfigMaps.
+// Keys that are not valid env var names, e.g. tls.crt, cause the loader to fail.
+func (k *Kubernetes) FromCluster(ctx context.Context, namespace string, configMaps, secrets []string) serum.Loader {
+	return serum.LoaderFunc(func(ij *serum.Injector) error {
+		vars := make(map[string]string)
+
+		for _, name := range configMaps {
+			cm, err := k.client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("error loading env vars from configmap %s: %w", name, err)
+			}
+
+			for key, v := range cm.Data {
+				if !envNameRe.MatchString(key) {
+					return fmt.Errorf("error loading env vars from configmap %s: invalid env var name %q", name, key)
+				}
+				vars[key] = v
+			}
+			for key, v := range cm.BinaryData {
+				if !envNameRe.MatchString(key) {
+					return fmt.Errorf("error loading env vars from configmap %s: invalid env var name %q", name, key)
+				}
+				vars[key] = string(v)
+			}
+		}
+
+		for _, name := range secrets {
+			s, err := k.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("error loading env vars from secret %s: %w", name, err)
+			}
+
+			for key := range s.Data {
+				if !envNameRe.MatchString(key) {
+					return fmt.Errorf("error loading env vars from secret %s: invalid env var name %q", name, key)
+				}
+				vars[key] = "!{" + Ref(namespace, name, key) + "}"
+			}
+			k.store(namespace, name, s.Data)
+		}
+
+		return serum.FromMap(vars).Load(ij)
+	})
+}
@@ -11,3 +11,19 @@ type SecretProvider interface {
 	Decrypt(ctx context.Context, secret string) (string, error)
 	Close() error
 }
+
+// BatchDecrypter is an optional interface that can be implemented by a SecretProvider
+// that is able to decrypt many secrets in a single call. When a SecretProvider implements
+// it, the Injector decrypts all of its secrets using one call to DecryptBatch.
+// The returned map is keyed by secret.
+type BatchDecrypter interface {
+	DecryptBatch(ctx context.Context, secrets []string) (map[string]string, error)
+}
+
+// Notifier is an optional interface that can be implemented by a SecretProvider that is able to
+// notify when secrets change, e.g. through a Pub/Sub subscription. Notify sends each secret that
+// changed to the changed channel until ctx is done, then it stops sending and returns. An Injector
+// watching for rotated secrets resolves its secrets again when it receives a notification.
+type Notifier interface {
+	Notify(ctx context.Context, changed chan<- string) error
+}
@@ -0,0 +1,142 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token" //nolint:gosec
+
+// AuthMethod authenticates against Vault and returns a client token.
+type AuthMethod interface {
+	login(ctx context.Context, c *client) (*tokenInfo, error)
+}
+
+// tokenInfo describes the token used to authenticate requests and
+// whether or not it should be renewed or revoked by the Vault provider.
+type tokenInfo struct {
+	token     string
+	ttl       time.Duration
+	renewable bool
+	// owned is true when the token was created by logging in and should
+	// be revoked when the provider is closed.
+	owned bool
+}
+
+type authResponse struct {
+	Auth *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+func (a *authResponse) tokenInfo() (*tokenInfo, error) {
+	if a.Auth == nil || a.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("login response did not contain a client token")
+	}
+
+	return &tokenInfo{
+		token:     a.Auth.ClientToken,
+		ttl:       time.Duration(a.Auth.LeaseDuration) * time.Second,
+		renewable: a.Auth.Renewable,
+		owned:     true,
+	}, nil
+}
+
+type tokenAuth struct {
+	token string
+}
+
+// TokenAuth returns an AuthMethod that uses an existing Vault token. The token is
+// looked up on creation and renewed in the background if it is renewable.
+func TokenAuth(token string) AuthMethod {
+	return &tokenAuth{token: token}
+}
+
+func (t *tokenAuth) login(ctx context.Context, c *client) (*tokenInfo, error) {
+	if t.token == "" {
+		return nil, fmt.Errorf("token is empty")
+	}
+	c.token = t.token
+
+	var resp struct {
+		Data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "auth/token/lookup-self", nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to lookup token: %w", err)
+	}
+
+	return &tokenInfo{
+		token:     t.token,
+		ttl:       time.Duration(resp.Data.TTL) * time.Second,
+		renewable: resp.Data.Renewable,
+	}, nil
+}
+
+type appRoleAuth struct {
+	roleID   string
+	secretID string
+}
+
+// AppRoleAuth returns an AuthMethod that logs in using the AppRole auth method
+// mounted at auth/approle.
+func AppRoleAuth(roleID, secretID string) AuthMethod {
+	return &appRoleAuth{roleID: roleID, secretID: secretID}
+}
+
+func (a *appRoleAuth) login(ctx context.Context, c *client) (*tokenInfo, error) {
+	body := map[string]string{
+		"role_id":   a.roleID,
+		"secret_id": a.secretID,
+	}
+
+	var resp authResponse
+	if err := c.do(ctx, http.MethodPost, "auth/approle/login", body, &resp); err != nil {
+		return nil, fmt.Errorf("approle login failed: %w", err)
+	}
+
+	return resp.tokenInfo()
+}
+
+type kubernetesAuth struct {
+	role      string
+	tokenPath string
+}
+
+// KubernetesAuth returns an AuthMethod that logs in using the Kubernetes auth method
+// mounted at auth/kubernetes. The service account token is read from tokenPath,
+// or from the default in-cluster location when tokenPath is empty.
+func KubernetesAuth(role, tokenPath string) AuthMethod {
+	if tokenPath == "" {
+		tokenPath = defaultServiceAccountTokenPath
+	}
+
+	return &kubernetesAuth{role: role, tokenPath: tokenPath}
+}
+
+func (k *kubernetesAuth) login(ctx context.Context, c *client) (*tokenInfo, error) {
+	jwt, err := ioutil.ReadFile(k.tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	body := map[string]string{
+		"role": k.role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	}
+
+	var resp authResponse
+	if err := c.do(ctx, http.MethodPost, "auth/kubernetes/login", body, &resp); err != nil {
+		return nil, fmt.Errorf("kubernetes login failed: %w", err)
+	}
+
+	return resp.tokenInfo()
+}
@@ -0,0 +1,283 @@
+// Package vault contains the secretprovider implementation
+// for HashiCorp Vault.
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	transitPrefix      = "vault:v"
+	fieldSeparator     = "#"
+	defaultTransit     = "transit"
+	revokeTimeout      = 5 * time.Second
+	kvVersionAutomatic = 0
+	kvVersion1         = 1
+	kvVersion2         = 2
+)
+
+// Option represents a function that can be passed into New to modify
+// the behavior of the Vault provider.
+type Option func(v *Vault)
+
+// WithHTTPClient sets the http client used to communicate with Vault.
+func WithHTTPClient(c *http.Client) Option {
+	return func(v *Vault) {
+		v.client.httpClient = c
+	}
+}
+
+// WithNamespace sets the Vault Enterprise namespace sent with every request.
+func WithNamespace(namespace string) Option {
+	return func(v *Vault) {
+		v.client.namespace = namespace
+	}
+}
+
+// WithKVVersion forces the version of the KV secrets engine (1 or 2). By default
+// the version is detected from the shape of the response.
+func WithKVVersion(version int) Option {
+	return func(v *Vault) {
+		v.kvVersion = version
+	}
+}
+
+// WithTransit sets the mount path and key name of the transit secrets engine used
+// to decrypt vault:v1:... ciphertexts. The mount defaults to "transit".
+func WithTransit(mount, key string) Option {
+	return func(v *Vault) {
+		if mount != "" {
+			v.transitMount = mount
+		}
+		v.transitKey = key
+	}
+}
+
+// Vault is a secret provider that communicates with HashiCorp Vault to decrypt secrets.
+// Secrets are either references into a KV secrets engine, in the form path#field, or
+// ciphertexts produced by the transit secrets engine, in the form vault:v1:....
+type Vault struct {
+	client       *client
+	kvVersion    int
+	transitMount string
+	transitKey   string
+
+	tokenInfo     *tokenInfo
+	renewInterval func(ttl time.Duration) time.Duration
+	cancel        context.CancelFunc
+	done          chan struct{}
+	closeOnce     sync.Once
+}
+
+// New returns an initialized Vault provider that has been authenticated against the
+// Vault server at addr using the provided AuthMethod. If addr is empty the VAULT_ADDR
+// env variable is used. Renewable tokens are renewed in the background until Close is called.
+func New(ctx context.Context, addr string, auth AuthMethod, options ...Option) (*Vault, error) {
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("vault: address is empty and VAULT_ADDR is not set")
+	}
+	if auth == nil {
+		return nil, fmt.Errorf("vault: auth method is nil")
+	}
+
+	v := &Vault{
+		client: &client{
+			addr:       addr,
+			httpClient: http.DefaultClient,
+		},
+		transitMount:  defaultTransit,
+		renewInterval: halfTTL,
+	}
+	for _, option := range options {
+		option(v)
+	}
+
+	ti, err := auth.login(ctx, v.client)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to authenticate: %w", err)
+	}
+	v.tokenInfo = ti
+	v.client.token = ti.token
+
+	v.startRenewal()
+	return v, nil
+}
+
+func halfTTL(ttl time.Duration) time.Duration {
+	return ttl / 2
+}
+
+// startRenewal starts a background goroutine renewing the token if it is renewable.
+func (v *Vault) startRenewal() {
+	if !v.tokenInfo.renewable || v.tokenInfo.ttl <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	v.cancel = cancel
+	v.done = make(chan struct{})
+	go v.renew(ctx, v.tokenInfo.ttl)
+}
+
+func (v *Vault) renew(ctx context.Context, ttl time.Duration) {
+	defer close(v.done)
+
+	for {
+		t := time.NewTimer(v.renewInterval(ttl))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		var resp authResponse
+		if err := v.client.do(ctx, http.MethodPost, "auth/token/renew-self", nil, &resp); err != nil {
+			return
+		}
+		if resp.Auth == nil || !resp.Auth.Renewable || resp.Auth.LeaseDuration <= 0 {
+			return
+		}
+		ttl = time.Duration(resp.Auth.LeaseDuration) * time.Second
+	}
+}
+
+// Decrypt will read the secret from Vault and return the plain text string.
+// Transit ciphertexts are decrypted with the configured transit key. Other secrets
+// are read from the KV engine; when a field is not specified the whole secret
+// is returned JSON encoded.
+func (v *Vault) Decrypt(ctx context.Context, secret string) (string, error) {
+	if strings.HasPrefix(secret, transitPrefix) {
+		return v.decryptTransit(ctx, secret)
+	}
+
+	return v.readKV(ctx, secret)
+}
+
+func (v *Vault) decryptTransit(ctx context.Context, ciphertext string) (string, error) {
+	if v.transitKey == "" {
+		return "", fmt.Errorf("vault: transit ciphertext found but no transit key is configured")
+	}
+
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	path := fmt.Sprintf("%s/decrypt/%s", v.transitMount, v.transitKey)
+	body := map[string]string{"ciphertext": ciphertext}
+	if err := v.client.do(ctx, http.MethodPost, path, body, &resp); err != nil {
+		return "", fmt.Errorf("vault: failed to decrypt transit ciphertext: %w", err)
+	}
+
+	plain, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return "", fmt.Errorf("vault: failed to decode transit plaintext: %w", err)
+	}
+
+	return string(plain), nil
+}
+
+func (v *Vault) readKV(ctx context.Context, secret string) (string, error) {
+	path, field := secret, ""
+	if i := strings.LastIndex(secret, fieldSeparator); i >= 0 {
+		path, field = secret[:i], secret[i+1:]
+	}
+	if path == "" {
+		return "", fmt.Errorf("vault: invalid secret reference %q", secret)
+	}
+
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := v.client.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return "", fmt.Errorf("vault: failed to read secret %s: %w", path, err)
+	}
+	if resp.Data == nil {
+		return "", fmt.Errorf("vault: secret %s not found", path)
+	}
+
+	data, err := v.kvData(resp.Data)
+	if err != nil {
+		return "", fmt.Errorf("vault: failed to read secret %s: %w", path, err)
+	}
+
+	if field == "" {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return "", fmt.Errorf("vault: failed to encode secret %s: %w", path, err)
+		}
+		return string(b), nil
+	}
+
+	val, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault: field %q not found in secret %s", field, path)
+	}
+	if s, ok := val.(string); ok {
+		return s, nil
+	}
+
+	b, err := json.Marshal(val)
+	if err != nil {
+		return "", fmt.Errorf("vault: failed to encode field %q of secret %s: %w", field, path, err)
+	}
+	return string(b), nil
+}
+
+// kvData unwraps the secret data of a KV v2 response. KV v1 responses are returned as is.
+func (v *Vault) kvData(data map[string]interface{}) (map[string]interface{}, error) {
+	switch v.kvVersion {
+	case kvVersion1:
+		return data, nil
+	case kvVersion2:
+		inner, ok := data["data"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("response is not a KV v2 secret")
+		}
+		return inner, nil
+	case kvVersionAutomatic:
+		inner, isMap := data["data"].(map[string]interface{})
+		_, hasMetadata := data["metadata"].(map[string]interface{})
+		if isMap && hasMetadata {
+			return inner, nil
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported KV version %d", v.kvVersion)
+	}
+}
+
+// Close stops renewing the token and revokes it if it was created by logging in.
+func (v *Vault) Close() error {
+	var err error
+	v.closeOnce.Do(func() {
+		if v.cancel != nil {
+			v.cancel()
+			<-v.done
+		}
+
+		if v.tokenInfo == nil || !v.tokenInfo.owned {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), revokeTimeout)
+		defer cancel()
+		if rErr := v.client.do(ctx, http.MethodPost, "auth/token/revoke-self", nil, nil); rErr != nil {
+			err = fmt.Errorf("vault: failed to revoke token: %w", rErr)
+		}
+	})
+
+	return err
+}
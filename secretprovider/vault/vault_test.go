@@ -0,0 +1,354 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const testToken = "s.testtoken"
+
+// fakeVault emulates the parts of the Vault HTTP API used by the provider.
+type fakeVault struct {
+	mu          sync.Mutex
+	renewable   bool
+	ttl         int
+	renewCalls  int
+	revokeCalls int
+	lastLogin   map[string]string
+}
+
+func (f *fakeVault) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+
+	login := func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		body := map[string]string{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("error decoding login body: %s", err)
+		}
+		f.lastLogin = body
+		if body["secret_id"] == "bad" || body["jwt"] == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["invalid credentials"]}`))
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   testToken,
+				"lease_duration": f.ttl,
+				"renewable":      f.renewable,
+			},
+		})
+	}
+	mux.HandleFunc("/v1/auth/approle/login", login)
+	mux.HandleFunc("/v1/auth/kubernetes/login", login)
+
+	authed := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") != testToken {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			h(w, r)
+		}
+	}
+
+	mux.HandleFunc("/v1/auth/token/lookup-self", authed(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{"ttl": f.ttl, "renewable": f.renewable},
+		})
+	}))
+	mux.HandleFunc("/v1/auth/token/renew-self", authed(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.renewCalls++
+		f.mu.Unlock()
+		writeJSON(w, map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": testToken, "lease_duration": f.ttl, "renewable": true},
+		})
+	}))
+	mux.HandleFunc("/v1/auth/token/revoke-self", authed(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.revokeCalls++
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/v1/kv/app", authed(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{"password": "hunter2", "port": 5432},
+		})
+	}))
+	mux.HandleFunc("/v1/secret/data/app", authed(func(w http.ResponseWriter, r *http.Request) {
+		password := "v2-password"
+		if r.URL.Query().Get("version") == "1" {
+			password = "v2-password-old"
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     map[string]interface{}{"password": password},
+				"metadata": map[string]interface{}{"version": 2},
+			},
+		})
+	}))
+	mux.HandleFunc("/v1/transit/decrypt/app-key", authed(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["ciphertext"] != "vault:v1:abcd" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["invalid ciphertext"]}`))
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{"plaintext": base64.StdEncoding.EncodeToString([]byte("transit secret"))},
+		})
+	}))
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestServer(t *testing.T, f *fakeVault) *httptest.Server {
+	srv := httptest.NewServer(f.handler(t))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNewAuth(t *testing.T) {
+	dir := t.TempDir()
+	jwtPath := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(jwtPath, []byte("service-account-jwt\n"), 0600); err != nil {
+		t.Fatalf("error writing jwt: %s", err)
+	}
+	badJWTPath := filepath.Join(dir, "bad")
+	if err := ioutil.WriteFile(badJWTPath, []byte("bad"), 0600); err != nil {
+		t.Fatalf("error writing jwt: %s", err)
+	}
+
+	tt := []struct {
+		name        string
+		auth        AuthMethod
+		expectOwned bool
+		expectedErr error
+	}{
+		{
+			name: "token",
+			auth: TokenAuth(testToken),
+		},
+		{
+			name:        "invalid token",
+			auth:        TokenAuth("wrong"),
+			expectedErr: errors.New("permission denied"),
+		},
+		{
+			name:        "empty token",
+			auth:        TokenAuth(""),
+			expectedErr: errors.New("token is empty"),
+		},
+		{
+			name:        "approle",
+			auth:        AppRoleAuth("role", "secret"),
+			expectOwned: true,
+		},
+		{
+			name:        "approle bad secret id",
+			auth:        AppRoleAuth("role", "bad"),
+			expectedErr: errors.New("invalid credentials"),
+		},
+		{
+			name:        "kubernetes",
+			auth:        KubernetesAuth("app", jwtPath),
+			expectOwned: true,
+		},
+		{
+			name:        "kubernetes bad jwt",
+			auth:        KubernetesAuth("app", badJWTPath),
+			expectedErr: errors.New("invalid credentials"),
+		},
+		{
+			name:        "kubernetes missing jwt",
+			auth:        KubernetesAuth("app", filepath.Join(dir, "missing")),
+			expectedErr: errors.New("failed to read service account token"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &fakeVault{}
+			srv := newTestServer(t, f)
+
+			v, err := New(context.Background(), srv.URL, tc.auth)
+			if tc.expectedErr != nil {
+				assert.Assert(t, v == nil)
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, v.tokenInfo.owned, tc.expectOwned)
+			assert.NilError(t, v.Close())
+
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if tc.expectOwned {
+				assert.Equal(t, f.revokeCalls, 1)
+			} else {
+				assert.Equal(t, f.revokeCalls, 0)
+			}
+		})
+	}
+}
+
+func TestNewAddrFromEnv(t *testing.T) {
+	srv := newTestServer(t, &fakeVault{})
+	os.Setenv("VAULT_ADDR", srv.URL)
+	defer os.Unsetenv("VAULT_ADDR")
+
+	v, err := New(context.Background(), "", TokenAuth(testToken))
+	assert.NilError(t, err)
+	assert.NilError(t, v.Close())
+}
+
+func TestDecrypt(t *testing.T) {
+	tt := []struct {
+		name        string
+		options     []Option
+		secret      string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "kv v1 field",
+			secret:   "kv/app#password",
+			expected: "hunter2",
+		},
+		{
+			name:     "kv v1 non string field",
+			secret:   "kv/app#port",
+			expected: "5432",
+		},
+		{
+			name:     "kv v1 whole secret",
+			secret:   "kv/app",
+			expected: `{"password":"hunter2","port":5432}`,
+		},
+		{
+			name:     "kv v2 field",
+			secret:   "secret/data/app#password",
+			expected: "v2-password",
+		},
+		{
+			name:     "kv v2 field with version",
+			secret:   "secret/data/app?version=1#password",
+			expected: "v2-password-old",
+		},
+		{
+			name:     "kv v2 forced v1",
+			options:  []Option{WithKVVersion(1)},
+			secret:   "secret/data/app#metadata",
+			expected: `{"version":2}`,
+		},
+		{
+			name:        "kv v2 forced on v1 secret",
+			options:     []Option{WithKVVersion(2)},
+			secret:      "kv/app#password",
+			expectedErr: errors.New("not a KV v2 secret"),
+		},
+		{
+			name:        "missing field",
+			secret:      "kv/app#user",
+			expectedErr: errors.New(`field "user" not found`),
+		},
+		{
+			name:        "missing secret",
+			secret:      "kv/missing#user",
+			expectedErr: errors.New("status 404"),
+		},
+		{
+			name:     "transit",
+			options:  []Option{WithTransit("", "app-key")},
+			secret:   "vault:v1:abcd",
+			expected: "transit secret",
+		},
+		{
+			name:        "transit bad ciphertext",
+			options:     []Option{WithTransit("transit", "app-key")},
+			secret:      "vault:v1:nope",
+			expectedErr: errors.New("invalid ciphertext"),
+		},
+		{
+			name:        "transit without key",
+			secret:      "vault:v1:abcd",
+			expectedErr: errors.New("no transit key is configured"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newTestServer(t, &fakeVault{})
+			v, err := New(context.Background(), srv.URL, TokenAuth(testToken), tc.options...)
+			assert.NilError(t, err)
+			defer v.Close()
+
+			dec, err := v.Decrypt(context.Background(), tc.secret)
+			if tc.expectedErr != nil {
+				assert.ErrorContains(t, err, tc.expectedErr.Error())
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, dec, tc.expected)
+		})
+	}
+}
+
+func TestTokenRenewal(t *testing.T) {
+	f := &fakeVault{renewable: true, ttl: 60}
+	srv := newTestServer(t, f)
+
+	renewed := make(chan struct{}, 1)
+	v := &Vault{
+		client: &client{addr: srv.URL, httpClient: srv.Client()},
+		renewInterval: func(ttl time.Duration) time.Duration {
+			select {
+			case renewed <- struct{}{}:
+			default:
+			}
+			return time.Millisecond
+		},
+	}
+	ti, err := AppRoleAuth("role", "secret").login(context.Background(), v.client)
+	assert.NilError(t, err)
+	v.tokenInfo = ti
+	v.client.token = ti.token
+	v.startRenewal()
+
+	// wait until at least one renewal has been scheduled after the first
+	<-renewed
+	<-renewed
+	assert.NilError(t, v.Close())
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	assert.Assert(t, f.renewCalls > 0)
+	assert.Equal(t, f.revokeCalls, 1)
+
+	// closing again is a no-op
+	assert.NilError(t, v.Close())
+}
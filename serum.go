@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/wingocard/serum/internal/envparser"
 	"github.com/wingocard/serum/secretprovider"
@@ -15,6 +16,19 @@ import (
 type Injector struct {
 	secretProvider secretprovider.SecretProvider
 	envVars        *envparser.EnvVars
+	secretFileDir  string
+	// secretFiles contains the paths of the files secrets were written to, keyed by env var
+	secretFiles map[string]string
+	// sourceFiles contains the paths of the .env files the env vars were loaded from, in order
+	sourceFiles []string
+
+	// mu guards the state shared with Watch
+	mu sync.Mutex
+	// decrypted contains the last decrypted value of the secrets, keyed by env var
+	decrypted     map[string]string
+	rotationFuncs map[string][]RotationFunc
+	changeFuncs   []ChangeFunc
+	config        *Config
 }
 
 // NewInjector creates a new injector loading from the provided loader
@@ -37,25 +51,40 @@ func NewInjector(loader Loader, options ...Option) (*Injector, error) {
 // Inject will inject the loaded environment variables into the current running process' environment.
 // Any secret values found will attempt to be decrypted using the provided SecretProvider.
 // The presence of secrets with a nil SecretProvider will return an error.
+// Secrets declared using !file{} are written to a file only readable by the current user and the
+// env var is set to the file's path. The files are removed when the Injector is closed.
 func (ij *Injector) Inject(ctx context.Context) error {
-	if len(ij.envVars.Secrets) > 0 && ij.secretProvider == nil {
+	env := ij.loaded()
+	if len(env.Secrets) > 0 && ij.secretProvider == nil {
 		return fmt.Errorf("serum: error injecting env vars: secrets were loaded but the SecretProvider is nil")
 	}
 
+	decrypted, err := ij.decryptSecrets(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+	ij.decrypted = decrypted
+
 	// inject secrets
-	for k, v := range ij.envVars.Secrets {
-		decrypted, err := ij.secretProvider.Decrypt(ctx, v)
-		if err != nil {
-			return fmt.Errorf("serum: error decrypting secret %s: %s", v, err)
+	for k, v := range decrypted {
+		if env.Files[k] {
+			path, err := ij.writeSecretFile(k, v)
+			if err != nil {
+				return fmt.Errorf("serum: error writing secret file for env var %s: %s", k, err)
+			}
+			v = path
 		}
 
-		if err := os.Setenv(k, decrypted); err != nil {
+		if err := os.Setenv(k, v); err != nil {
 			return fmt.Errorf("serum: error setting env var %s: %s", k, err)
 		}
 	}
 
 	// inject plain text vars
-	for k, v := range ij.envVars.Plain {
+	for k, v := range env.Plain {
 		if err := os.Setenv(k, v); err != nil {
 			return fmt.Errorf("serum: error setting env var %s: %s", k, err)
 		}
@@ -63,11 +92,129 @@ func (ij *Injector) Inject(ctx context.Context) error {
 	return nil
 }
 
-// Close will close any open clients in the Injector.
+// Resolve returns the loaded environment variables with their secrets decrypted, without injecting
+// them into the current running process' environment. Secrets declared using !file{} are resolved to
+// their decrypted value and are not written to a file. The presence of secrets with a nil
+// SecretProvider will return an error.
+func (ij *Injector) Resolve(ctx context.Context) (map[string]string, error) {
+	return ij.resolve(ctx, ij.loaded())
+}
+
+// resolve decrypts the secrets of env and returns them along with its plain text vars.
+func (ij *Injector) resolve(ctx context.Context, env *envparser.EnvVars) (map[string]string, error) {
+	if len(env.Secrets) > 0 && ij.secretProvider == nil {
+		return nil, fmt.Errorf("serum: error resolving env vars: secrets were loaded but the SecretProvider is nil")
+	}
+
+	decrypted, err := ij.decryptSecrets(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+
+	return merge(env.Plain, decrypted), nil
+}
+
+// merge returns the plain text vars and the decrypted secrets in a single map.
+func merge(plain, decrypted map[string]string) map[string]string {
+	resolved := make(map[string]string, len(plain)+len(decrypted))
+	for k, v := range decrypted {
+		resolved[k] = v
+	}
+	for k, v := range plain {
+		resolved[k] = v
+	}
+	return resolved
+}
+
+// loaded returns the loaded env vars. They are replaced, never modified, when watched files change.
+func (ij *Injector) loaded() *envparser.EnvVars {
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+
+	return ij.envVars
+}
+
+// decryptSecrets decrypts the secrets of env and returns the plain text values keyed by env var.
+// The JSON field and modifiers of a secret reference are applied to the decrypted value.
+func (ij *Injector) decryptSecrets(ctx context.Context, env *envparser.EnvVars) (map[string]string, error) {
+	decrypted := make(map[string]string, len(env.Secrets))
+	if len(env.Secrets) == 0 {
+		return decrypted, nil
+	}
+
+	refs := make(map[string]*reference, len(env.Secrets))
+	seen := make(map[string]bool, len(env.Secrets))
+	secrets := make([]string, 0, len(env.Secrets))
+	for k, v := range env.Secrets {
+		r, err := parseReference(v)
+		if err != nil {
+			return nil, fmt.Errorf("serum: error parsing secret %s: %s", k, err)
+		}
+		refs[k] = r
+
+		if !seen[r.secret] {
+			seen[r.secret] = true
+			secrets = append(secrets, r.secret)
+		}
+	}
+
+	values, err := ij.decrypt(ctx, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, r := range refs {
+		d, err := r.apply(values[r.secret])
+		if err != nil {
+			return nil, fmt.Errorf("serum: error transforming secret %s: %s", env.Secrets[k], err)
+		}
+		decrypted[k] = d
+	}
+
+	return decrypted, nil
+}
+
+// decrypt decrypts the secrets and returns the plain text values keyed by secret.
+// SecretProviders that implement secretprovider.BatchDecrypter decrypt all secrets in a single call.
+func (ij *Injector) decrypt(ctx context.Context, secrets []string) (map[string]string, error) {
+	bd, ok := ij.secretProvider.(secretprovider.BatchDecrypter)
+	if !ok {
+		values := make(map[string]string, len(secrets))
+		for _, s := range secrets {
+			d, err := ij.secretProvider.Decrypt(ctx, s)
+			if err != nil {
+				return nil, fmt.Errorf("serum: error decrypting secret %s: %s", s, err)
+			}
+			values[s] = d
+		}
+		return values, nil
+	}
+
+	values, err := bd.DecryptBatch(ctx, secrets)
+	if err != nil {
+		return nil, fmt.Errorf("serum: error decrypting secrets: %s", err)
+	}
+
+	for _, s := range secrets {
+		if _, ok := values[s]; !ok {
+			return nil, fmt.Errorf("serum: error decrypting secret %s: missing from batch result", s)
+		}
+	}
+
+	return values, nil
+}
+
+// Close will remove the secret files written by Inject and close any open clients in the Injector.
 func (ij *Injector) Close() error {
+	ij.mu.Lock()
+	err := ij.removeSecretFiles()
+	ij.mu.Unlock()
 	if ij.secretProvider == nil {
-		return nil
+		return err
 	}
 
-	return ij.secretProvider.Close()
+	if cerr := ij.secretProvider.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
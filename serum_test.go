@@ -212,6 +212,156 @@ func TestInject(t *testing.T) {
 	}
 }
 
+type testBatchSecretProvider struct {
+	testSecretProvider
+	batchCalls [][]string
+}
+
+func (ts *testBatchSecretProvider) DecryptBatch(ctx context.Context, secrets []string) (map[string]string, error) {
+	ts.batchCalls = append(ts.batchCalls, secrets)
+	if ts.returnErr != nil {
+		return nil, ts.returnErr
+	}
+
+	values := make(map[string]string)
+	for _, s := range secrets {
+		if v, ok := ts.returnSecret[s]; ok {
+			values[s] = v
+		}
+	}
+	return values, nil
+}
+
+func TestInjectBatch(t *testing.T) {
+	env := &envparser.EnvVars{
+		Secrets: map[string]string{
+			"artorias": "abysswalker",
+			"knight":   "abysswalker",
+			"ornstein": "dragonslayer",
+		},
+	}
+	sp := &testBatchSecretProvider{
+		testSecretProvider: testSecretProvider{
+			returnSecret: map[string]string{
+				"abysswalker":  "great sword",
+				"dragonslayer": "spear",
+			},
+		},
+	}
+	ij := &Injector{envVars: env, secretProvider: sp}
+
+	err := ij.Inject(context.Background())
+	assert.NilError(t, err)
+	defer cleanupEnv(env) //nolint:errcheck
+
+	assert.Equal(t, len(sp.batchCalls), 1)
+	assert.Equal(t, len(sp.batchCalls[0]), 2)
+	assert.Equal(t, os.Getenv("artorias"), "great sword")
+	assert.Equal(t, os.Getenv("knight"), "great sword")
+	assert.Equal(t, os.Getenv("ornstein"), "spear")
+}
+
+func TestInjectBatchError(t *testing.T) {
+	tt := []struct {
+		name        string
+		sp          *testBatchSecretProvider
+		expectedErr error
+	}{
+		{
+			name: "batch error",
+			sp: &testBatchSecretProvider{
+				testSecretProvider: testSecretProvider{returnErr: errors.New("plugin failed")},
+			},
+			expectedErr: errors.New("serum: error decrypting secrets: plugin failed"),
+		},
+		{
+			name:        "missing from result",
+			sp:          &testBatchSecretProvider{},
+			expectedErr: errors.New("serum: error decrypting secret gwyn: missing from batch result"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ij := &Injector{
+				envVars: &envparser.EnvVars{
+					Secrets: map[string]string{"lord": "gwyn"},
+				},
+				secretProvider: tc.sp,
+			}
+
+			err := ij.Inject(context.Background())
+			assert.ErrorContains(t, err, tc.expectedErr.Error())
+		})
+	}
+}
+
+func TestInjectReferences(t *testing.T) {
+	env := &envparser.EnvVars{
+		Secrets: map[string]string{
+			"DB_USER":     "db-credentials#.user",
+			"DB_PASSWORD": "db-credentials#.password|trim",
+			"TLS_KEY":     "tls-key|base64decode",
+		},
+	}
+	sp := &testBatchSecretProvider{
+		testSecretProvider: testSecretProvider{
+			returnSecret: map[string]string{
+				"db-credentials": `{"user": "admin", "password": " hunter2 "}`,
+				"tls-key":        "c3VwZXJTZWNyZXQ=",
+			},
+		},
+	}
+	ij := &Injector{envVars: env, secretProvider: sp}
+
+	err := ij.Inject(context.Background())
+	assert.NilError(t, err)
+	defer cleanupEnv(env) //nolint:errcheck
+
+	assert.Equal(t, len(sp.batchCalls), 1)
+	assert.Equal(t, len(sp.batchCalls[0]), 2)
+	assert.Equal(t, os.Getenv("DB_USER"), "admin")
+	assert.Equal(t, os.Getenv("DB_PASSWORD"), "hunter2")
+	assert.Equal(t, os.Getenv("TLS_KEY"), "superSecret")
+}
+
+func TestResolve(t *testing.T) {
+	ij := &Injector{
+		envVars: &envparser.EnvVars{
+			Plain: map[string]string{
+				"gwyn": "lord of cinder",
+			},
+			Secrets: map[string]string{
+				"sif":      "greatWolf",
+				"artorias": "abysswalker",
+			},
+			Files: map[string]bool{
+				"artorias": true,
+			},
+		},
+		secretProvider: &testSecretProvider{
+			returnSecret: map[string]string{
+				"greatWolf":   "great wolf",
+				"abysswalker": "great sword",
+			},
+		},
+	}
+
+	resolved, err := ij.Resolve(context.Background())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, resolved, map[string]string{
+		"gwyn":     "lord of cinder",
+		"sif":      "great wolf",
+		"artorias": "great sword",
+	})
+	assert.Equal(t, os.Getenv("sif"), "")
+	assert.Equal(t, len(ij.secretFiles), 0)
+
+	ij.secretProvider = nil
+	_, err = ij.Resolve(context.Background())
+	assert.ErrorContains(t, err, "secrets were loaded but the SecretProvider is nil")
+}
+
 func TestInjectError(t *testing.T) {
 	tt := []struct {
 		name           string
@@ -261,6 +411,28 @@ func TestInjectError(t *testing.T) {
 			},
 			expectedErr: errors.New("error decrypting secret"),
 		},
+		{
+			name: "invalid reference",
+			env: &envparser.EnvVars{
+				Secrets: map[string]string{
+					"solaire": "of astora#.",
+				},
+			},
+			secretprovider: &testSecretProvider{},
+			expectedErr:    errors.New("serum: error parsing secret solaire: invalid field"),
+		},
+		{
+			name: "transform error",
+			env: &envparser.EnvVars{
+				Secrets: map[string]string{
+					"solaire": "of astora#.sun",
+				},
+			},
+			secretprovider: &testSecretProvider{
+				returnSecret: map[string]string{"of astora": "praise the sun"},
+			},
+			expectedErr: errors.New("serum: error transforming secret of astora#.sun: value is not a JSON document"),
+		},
 	}
 
 	for _, tc := range tt {